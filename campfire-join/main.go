@@ -14,16 +14,25 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"campfire/pkg/campfire"
 )
 
 func main() {
 	campURI := flag.String("camp", "camp://turn?fingerprint#psk", "camp URI")
+	code := flag.String("code", "", "code of the waiting peer, instead of a camp URI")
+	servers := flag.String("servers", "campfire:campfire@127.0.0.1:3478", "comma separated servers to meet at with a code")
 	//logLevel := flag.String("log-level", "info", "log level")
 	flag.Parse()
 	//log := util.SetupLogging(*logLevel)
-	ourcamp, err := campfire.ParseCampfireURI(*campURI)
+	var ourcamp *campfire.CampfireURI
+	var err error
+	if *code != "" {
+		ourcamp, err = campfire.NewCodeCampfire(*code, strings.Split(*servers, ","))
+	} else {
+		ourcamp, err = campfire.ParseCampfireURI(*campURI)
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
@@ -38,14 +47,13 @@ func main() {
 	fmt.Println(">>> Connected to peer")
 	go func() {
 		defer conn.Close()
-		buf := make([]byte, 1024)
 		for {
-			n, err := conn.Read(buf)
+			msg, _, err := conn.ReadMessage()
 			if err != nil {
 				//log.Error("error", "error", err.Error())
 				return
 			}
-			fmt.Println("remote:", string(buf[:n]))
+			fmt.Println("remote:", string(msg))
 			fmt.Print("> ")
 		}
 	}()
@@ -57,7 +65,7 @@ func main() {
 			//log.Error("error", "error", err.Error())
 			return
 		}
-		_, err = conn.Write(bytes.TrimSpace(line))
+		err = conn.WriteMessage(bytes.TrimSpace(line), true)
 		if err != nil {
 			//log.Error("error", "error", err.Error())
 			return
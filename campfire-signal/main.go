@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+// Command campfire-signal runs a rendezvous server that relays offers,
+// answers and candidates between the peers meeting at a campfire.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"campfire/pkg/campfire/rendezvous"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:8080", "address to serve WebSocket and HTTP signaling on")
+	listenUDP := flag.String("listen-udp", "", "address to serve UDP signaling on, disabled if empty")
+	certFile := flag.String("cert", "", "TLS certificate, serves wss:// and https:// when set")
+	keyFile := flag.String("key", "", "TLS private key")
+	logLevel := flag.String("log-level", "info", "log level")
+	flag.Parse()
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		fmt.Fprintln(os.Stderr, "invalid log level:", err)
+		os.Exit(1)
+	}
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(log)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	hub := rendezvous.NewHub()
+	if *listenUDP != "" {
+		conn, err := net.ListenPacket("udp", *listenUDP)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		defer conn.Close()
+		go func() {
+			if err := rendezvous.NewPacketServer(hub, conn).Serve(); err != nil {
+				log.Error("udp signaling stopped", "err", err)
+			}
+		}()
+		log.Info("Serving UDP signaling", "addr", conn.LocalAddr().String())
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	server := &http.Server{
+		Handler:           rendezvous.NewHandler(hub),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	scheme := "ws"
+	if *certFile != "" {
+		scheme = "wss"
+	}
+	fmt.Printf(">>> Signaling at %s://%s/\n", scheme, ln.Addr().String())
+	if *certFile != "" {
+		err = server.ServeTLS(ln, *certFile, *keyFile)
+	} else {
+		err = server.Serve(ln)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
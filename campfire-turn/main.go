@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+// Command campfire-turn runs a TURN server that also carries campfire
+// signaling, so a single UDP port is all a campfire needs.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"campfire/pkg/campfire/turnserver"
+)
+
+func main() {
+	listen := flag.String("listen", ":3478", "UDP address to listen on")
+	publicIP := flag.String("public-ip", "127.0.0.1", "IP address advertised for relayed connections")
+	relayAddress := flag.String("relay-address", "0.0.0.0", "address relayed connections are bound to")
+	realm := flag.String("realm", turnserver.DefaultRealm, "TURN realm")
+	users := flag.String("users", "", "comma separated list of user=password pairs allowed to relay")
+	noCampfire := flag.Bool("no-campfire", false, "disable campfire signaling")
+	logLevel := flag.String("log-level", "info", "log level")
+	flag.Parse()
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		fmt.Fprintln(os.Stderr, "invalid log level:", err)
+		os.Exit(1)
+	}
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(log)
+
+	if *users == "" {
+		fmt.Fprintln(os.Stderr, "at least one user is required, e.g. -users campfire=campfire")
+		os.Exit(1)
+	}
+	credentials := make(map[string]string)
+	for _, pair := range strings.Split(*users, ",") {
+		user, pass, ok := strings.Cut(pair, "=")
+		if !ok || user == "" {
+			fmt.Fprintf(os.Stderr, "invalid user %q, expected user=password\n", pair)
+			os.Exit(1)
+		}
+		credentials[user] = pass
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server, err := turnserver.NewServer(&turnserver.Options{
+		PublicIP:        *publicIP,
+		RelayAddressUDP: *relayAddress,
+		ListenUDP:       *listen,
+		Realm:           *realm,
+		Users:           credentials,
+		EnableCampfire:  !*noCampfire,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	defer server.Close()
+	fmt.Printf(">>> TURN at %s:%d\n", *publicIP, server.ListenPort())
+	<-ctx.Done()
+}
@@ -15,6 +15,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/pion/webrtc/v3"
 )
@@ -22,10 +23,12 @@ import (
 func main() {
 	var dtlsCert *webrtc.Certificate
 	fmt.Println(len(os.Args), os.Args)
-	campURI := flag.String("camp", "camp://5FF63B46BE4BA722F44A29F7C54F35DAA944241CCB937864FD38E363754661E1/?0=9d4e8faba9a93ef397554dc4:hLxK4U49l6fcZLH0@a.relay.metered.ca#abcdefghijklmnopqrstuvwx12345678", "camp URI")
+	campURI := flag.String("camp", "camp://5FF63B46BE4BA722F44A29F7C54F35DAA944241CCB937864FD38E363754661E1/?0=campfire:campfire@127.0.0.1:3478#abcdefghijklmnopqrstuvwx12345678", "camp URI")
 	//logLevel := flag.String("log-level", "info", "log level")
 	certFile := flag.String("cert", "cert.pem", "x509 cert")
 	keyFile := flag.String("key", "key.pem", "private key")
+	code := flag.String("code", "", `code to wait with instead of a camp URI, "new" generates one`)
+	servers := flag.String("servers", "campfire:campfire@127.0.0.1:3478", "comma separated servers to meet at with a code")
 	flag.Parse()
 	//log := util.SetupLogging(*logLevel)
 
@@ -35,7 +38,21 @@ func main() {
 	}
 	fmt.Println("Conneting to:", campURI)
 	ctx := context.Background()
-	ourcamp, err := campfire.ParseCampfireURI(*campURI)
+	var ourcamp *campfire.CampfireURI
+	var err error
+	if *code != "" {
+		if *code == "new" {
+			*code, err = campfire.GenerateCode()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to generate code", err)
+				os.Exit(1)
+			}
+			fmt.Println(">>> Code:", *code)
+		}
+		ourcamp, err = campfire.NewCodeCampfire(*code, strings.Split(*servers, ","))
+	} else {
+		ourcamp, err = campfire.ParseCampfireURI(*campURI)
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "a Camp URL is required", err)
 		os.Exit(1)
@@ -51,7 +68,7 @@ func main() {
 	}
 
 	//Wait at a specific campfire:
-	cf, err := ourcamp.Wait(ctx, dtlsCert)
+	cf, err := ourcamp.Wait(ctx, campfire.WithCertificate(dtlsCert))
 
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
@@ -80,14 +97,13 @@ func main() {
 	fmt.Println(">>> New peer connection")
 	go func() {
 		defer conn.Close()
-		buf := make([]byte, 1024)
 		for {
-			n, err := conn.Read(buf)
+			msg, _, err := conn.ReadMessage()
 			if err != nil {
 				//log.Error("error", "error", err.Error())
 				return
 			}
-			fmt.Println("remote:", string(buf[:n]))
+			fmt.Println("remote:", string(msg))
 			fmt.Print("> ")
 		}
 	}()
@@ -99,7 +115,7 @@ func main() {
 			//log.Error("error", "error", err.Error())
 			return
 		}
-		_, err = conn.Write(bytes.TrimSpace(line))
+		err = conn.WriteMessage(bytes.TrimSpace(line), true)
 		if err != nil {
 			//log.Error("error", "error", err.Error())
 			return
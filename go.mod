@@ -2,10 +2,18 @@ module campfire
 
 go 1.21.0
 
+require (
+	github.com/google/uuid v1.3.0
+	github.com/pion/datachannel v1.5.5
+	github.com/pion/sdp/v3 v3.0.6
+	github.com/pion/turn/v2 v2.1.3
+	github.com/pion/webrtc/v3 v3.2.17
+	golang.org/x/crypto v0.11.0
+	golang.org/x/net v0.13.0
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/google/uuid v1.3.0 // indirect
-	github.com/pion/datachannel v1.5.5 // indirect
 	github.com/pion/dtls/v2 v2.2.7 // indirect
 	github.com/pion/ice/v2 v2.3.10 // indirect
 	github.com/pion/interceptor v0.1.17 // indirect
@@ -15,16 +23,11 @@ require (
 	github.com/pion/rtcp v1.2.10 // indirect
 	github.com/pion/rtp v1.8.1 // indirect
 	github.com/pion/sctp v1.8.8 // indirect
-	github.com/pion/sdp/v3 v3.0.6 // indirect
 	github.com/pion/srtp/v2 v2.0.16 // indirect
 	github.com/pion/stun v0.6.1 // indirect
 	github.com/pion/transport/v2 v2.2.1 // indirect
-	github.com/pion/turn/v2 v2.1.3 // indirect
-	github.com/pion/webrtc/v3 v3.2.17 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/testify v1.8.4 // indirect
-	golang.org/x/crypto v0.11.0 // indirect
-	golang.org/x/net v0.13.0 // indirect
 	golang.org/x/sys v0.10.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -16,28 +16,41 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
-	"io"
 	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 )
 
-// Protocol is the protocol name.
-const Protocol = "/campfire/1.0.0"
+// Protocol versions.
+const (
+	// ProtocolV1 derives secrets with AES-CBC and data channel labels by
+	// hashing them with SHA-256. It is kept for interop with existing peers.
+	ProtocolV1 = "/campfire/1.0.0"
+	// ProtocolV2 derives every secret with HKDF under its own label.
+	ProtocolV2 = "/campfire/2.0.0"
+)
+
+// Protocol is the protocol name of the current version.
+const Protocol = ProtocolV2
 
 // CampfireChannel is a connection to one or more peers sharing the same pre-shared
 // key.
 type CampfireChannel interface {
 	// Accept returns a connection to a peer.
-	Accept() (io.ReadWriteCloser, error)
+	Accept() (*Peer, error)
+	// Peers returns the peers that are connected.
+	Peers() []*Peer
 	// Close closes the camp fire.
 	Close() error
 	// Errors returns a channel of errors.
 	Errors() <-chan error
+	// Events returns a channel of the events of the peers.
+	Events() <-chan Event
 	// Expired returns a channel that is closed when the camp fire expires.
 	Expired() <-chan struct{}
 	// Opened returns true if the camp fire is open.
@@ -56,11 +69,66 @@ type CampfireOffer struct {
 	SDP webrtc.SessionDescription
 }
 
+// CampfireAnswer represents an answer that was received from a peer.
+type CampfireAnswer struct {
+	// ID contains the ID of the offer being answered.
+	ID string
+	// Ufrag contains the username fragment of the peer that sent the answer.
+	Ufrag string
+	// Pwd contains the password of the peer that sent the answer.
+	Pwd string
+	// SDP contains the SDP of the answer.
+	SDP webrtc.SessionDescription
+}
+
+// CampfireCandidate represents an ICE candidate that was received from a peer.
+type CampfireCandidate struct {
+	// ID contains the ID of the offer the candidate belongs to.
+	ID string
+	// Ufrag contains the username fragment of the peer that sent the candidate.
+	Ufrag string
+	// Pwd contains the password of the peer that sent the candidate.
+	Pwd string
+	// Cand contains the ICE candidate.
+	Cand webrtc.ICECandidateInit
+}
+
 var (
 	// ErrClosed is returned when the camp fire is closed.
 	ErrClosed = net.ErrClosed
+	// ErrInvalidCredentials is returned when a peer presents ICE credentials
+	// that were not derived from the pre-shared key.
+	ErrInvalidCredentials = errors.New("invalid ICE credentials")
 )
 
+// checkCredentials returns ErrInvalidCredentials unless the session
+// description carries the given ICE credentials.
+func checkCredentials(desc webrtc.SessionDescription, ufrag, pwd string) error {
+	parsed, err := desc.Unmarshal()
+	if err != nil {
+		return fmt.Errorf("parse session description: %w", err)
+	}
+	sessionUfrag, _ := parsed.Attribute("ice-ufrag")
+	sessionPwd, _ := parsed.Attribute("ice-pwd")
+	if len(parsed.MediaDescriptions) == 0 && (sessionUfrag != ufrag || sessionPwd != pwd) {
+		return ErrInvalidCredentials
+	}
+	// Media level credentials take precedence over session level ones.
+	for _, media := range parsed.MediaDescriptions {
+		gotUfrag, gotPwd := sessionUfrag, sessionPwd
+		if v, ok := media.Attribute("ice-ufrag"); ok {
+			gotUfrag = v
+		}
+		if v, ok := media.Attribute("ice-pwd"); ok {
+			gotPwd = v
+		}
+		if gotUfrag != ufrag || gotPwd != pwd {
+			return ErrInvalidCredentials
+		}
+	}
+	return nil
+}
+
 func LoadCertificateFromPEMFile(certPath string, keyPath string) (webrtc.Certificate, error) {
 	var dtlsCert webrtc.Certificate
 	certPEM, err := os.ReadFile(certPath)
@@ -97,10 +165,74 @@ func LoadCertificateFromPEMFile(certPath string, keyPath string) (webrtc.Certifi
 	return dtlsCert, nil
 }
 
-func (camp *CampfireURI) getTemporalKey(IV string) string {
-	currentTime := time.Now().UTC()
-	roundedTime := currentTime.Round(time.Hour)
-	timeString := roundedTime.Format("2006010215") // Format: YYYYMMDDHH
+// CertificateFingerprint returns the SHA-256 fingerprint of the certificate
+// as it appears in the host of a camp URI.
+func CertificateFingerprint(cert *webrtc.Certificate) (string, error) {
+	fingerprint, err := sdpCertificateFingerprint(cert)
+	if err != nil {
+		return "", err
+	}
+	return normalizeFingerprint(fingerprint), nil
+}
+
+// sdpCertificateFingerprint returns the SHA-256 fingerprint of the
+// certificate as it appears in a session description.
+func sdpCertificateFingerprint(cert *webrtc.Certificate) (string, error) {
+	if cert == nil {
+		return "", errors.New("no certificate")
+	}
+	fingerprints, err := cert.GetFingerprints()
+	if err != nil {
+		return "", fmt.Errorf("certificate fingerprints: %w", err)
+	}
+	for _, fingerprint := range fingerprints {
+		if fingerprint.Algorithm == "sha-256" {
+			return strings.ToUpper(fingerprint.Value), nil
+		}
+	}
+	return "", errors.New("certificate has no sha-256 fingerprint")
+}
+
+// remoteFingerprint returns the SHA-256 DTLS fingerprint of the session
+// description.
+func remoteFingerprint(desc webrtc.SessionDescription) (string, error) {
+	parsed, err := desc.Unmarshal()
+	if err != nil {
+		return "", fmt.Errorf("parse session description: %w", err)
+	}
+	attributes := parsed.Attributes
+	for _, media := range parsed.MediaDescriptions {
+		attributes = append(attributes, media.Attributes...)
+	}
+	for _, attr := range attributes {
+		if attr.Key != "fingerprint" {
+			continue
+		}
+		algorithm, value, ok := strings.Cut(attr.Value, " ")
+		if ok && strings.EqualFold(algorithm, "sha-256") {
+			return normalizeFingerprint(value), nil
+		}
+	}
+	return "", errors.New("session description has no sha-256 fingerprint")
+}
+
+// normalizeFingerprint strips the colons from a fingerprint and upper cases
+// it, so fingerprints from URIs and session descriptions compare equal.
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToUpper(strings.ReplaceAll(fingerprint, ":", ""))
+}
+
+// getTemporalKey derives a key for IV from the PSK and the epoch now falls in.
+func (camp *CampfireURI) getTemporalKey(IV string, now time.Time) string {
+	epoch, err := camp.Epoch()
+	if err != nil {
+		epoch = DefaultEpoch
+	}
+	start := epochStart(now, epoch)
+	if version, _ := camp.Version(); version != ProtocolV1 {
+		return hex.EncodeToString(deriveKey([]byte(camp.PSK), start, epoch, labelTemporalKey+IV, sha256.Size))
+	}
+	timeString := formatEpoch(start, epoch, "2006010215") // Format: YYYYMMDDHH
 
 	pskBytes := []byte(camp.PSK)
 	key := []byte(timeString + IV)
@@ -114,13 +246,16 @@ func (camp *CampfireURI) getTemporalKey(IV string) string {
 	return hmacHex
 }
 
-func (camp *CampfireURI) CampfireOffer(isLocal bool) (*webrtc.SessionDescription, error) {
+func (camp *CampfireURI) CampfireOffer(isLocal bool, cert *webrtc.Certificate) (*webrtc.SessionDescription, error) {
 	sdp_type := webrtc.SDPTypeOffer
 	if isLocal {
 		sdp_type = webrtc.SDPTypeAnswer
 	}
-	fingerprint := "5F:F6:3B:46:BE:4B:A7:22:F4:4A:29:F7:C5:4F:35:DA:A9:44:24:1C:CB:93:78:64:FD:38:E3:63:75:46:61:E1"
-	sessionID := camp.getTemporalKey(sdp_type.String())
+	fingerprint, err := sdpCertificateFingerprint(cert)
+	if err != nil {
+		return nil, err
+	}
+	sessionID := camp.getTemporalKey(sdp_type.String(), SystemClock.Now())
 	const SDPTemplate = "v=0\r\no=- %s 1 IN IP4 0.0.0.0\r\ns=-\r\nt=0 0\r\na=fingerprint:sha-256 %s\r\na=extmap-allow-mixed\r\na=group:BUNDLE\r\n"
 	mySDP := fmt.Sprintf(SDPTemplate, sessionID, fingerprint)
 	/*	const SDPTemplate = `v=0
@@ -135,12 +270,11 @@ func (camp *CampfireURI) CampfireOffer(isLocal bool) (*webrtc.SessionDescription
 		a=ice-ufrag:PHsS
 		a=ice-pwd:FL2ncYZ/dq6j4HQtzNzlTIA=
 		a=ice-options:trickle
-		a=fingerprint:sha-256 5F:F6:3B:46:BE:4B:A7:22:F4:4A:29:F7:C5:4F:35:DA:A9:44:24:1C:CB:93:78:64:FD:38:E3:63:75:46:61:E1
+		a=fingerprint:sha-256 %s
 		a=setup:actpass
 		a=mid:0
 		a=sctp-port:5000
-		a=max-message-size:262144
-		a=turn:a.relay.metered.ca username=9d4e8faba9a93ef397554dc4 password=hLxK4U49l6fcZLH0
+		a=max-message-size:65536
 		`*/
 	webrtc_sdp := webrtc.SessionDescription{
 		Type: sdp_type,
@@ -149,7 +283,11 @@ func (camp *CampfireURI) CampfireOffer(isLocal bool) (*webrtc.SessionDescription
 	return &webrtc_sdp, nil
 }
 
-func (camp *CampfireURI) CampfireOfferStruct(isLocal bool) (*webrtc.SessionDescription, error) {
+func (camp *CampfireURI) CampfireOfferStruct(isLocal bool, cert *webrtc.Certificate) (*webrtc.SessionDescription, error) {
+	fingerprint, err := sdpCertificateFingerprint(cert)
+	if err != nil {
+		return nil, err
+	}
 	port := 5000
 	//ttl := 64
 	rng := 1
@@ -159,9 +297,10 @@ func (camp *CampfireURI) CampfireOfferStruct(isLocal bool) (*webrtc.SessionDescr
 		sdp_type = webrtc.SDPTypeAnswer
 	}
 	// Both sides need the same Session ID:
-	session := camp.getTemporalKey("session")
+	now := SystemClock.Now()
+	session := camp.getTemporalKey("session", now)
 	// But they need a unique username:
-	username := camp.getTemporalKey(sdp_type.String())
+	username := camp.getTemporalKey(sdp_type.String(), now)
 
 	localAddress := &sdp.Address{
 		Address: "127.0.0.1",
@@ -202,7 +341,7 @@ func (camp *CampfireURI) CampfireOfferStruct(isLocal bool) (*webrtc.SessionDescr
 	}
 	fingerprintAttribute := sdp.Attribute{
 		Key:   "fingerprint",
-		Value: "your-username-fragment",
+		Value: "sha-256 " + fingerprint,
 	}
 	sdpSession.Attributes = append(sdpSession.Attributes, ufragAttribute)
 	sdpSession.Attributes = append(sdpSession.Attributes, pwdAttribute)
@@ -227,7 +366,7 @@ func (camp *CampfireURI) CampfireOfferStruct(isLocal bool) (*webrtc.SessionDescr
 			},
 			{
 				Key:   "max-message-size",
-				Value: "65535", // Fill in with your desired maximum message size
+				Value: strconv.Itoa(MaxMessageSize),
 			},
 		},
 	}
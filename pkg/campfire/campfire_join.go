@@ -8,44 +8,87 @@ package campfire
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io"
+
+	"github.com/google/uuid"
+	"github.com/pion/datachannel"
+	"github.com/pion/webrtc/v3"
 )
 
 // Join will attempt to join the peer waiting at the given location.
-func Join(ctx context.Context, camp *CampfireURI) (io.ReadWriteCloser, error) {
-	/*log := context.LoggerFrom(ctx).With("protocol", "campfire")
-	location, err := Find(camp.PSK, camp.TURNServers)
+func Join(ctx context.Context, camp *CampfireURI, opts ...Option) (*Conn, error) {
+	campOpts, err := camp.options()
 	if err != nil {
-		return nil, fmt.Errorf("find campfire: %w", err)
+		return nil, err
 	}
-	if !strings.HasPrefix(location.TURNServer, "turn:") {
-		location.TURNServer = "turn:" + location.TURNServer
+	o := newOptions(append(campOpts, opts...))
+	if _, err := o.policy.configuration(camp); err != nil {
+		return nil, err
 	}
-	// Parse the selected turn server
-	fireconn, err := camp.NewCampfireClient()
+	psk, err := camp.Key()
 	if err != nil {
-		return nil, fmt.Errorf("new campfire client: %w", err)
+		return nil, err
 	}
-	defer fireconn.Close()
-	s := webrtc.SettingEngine{}
-	s.DetachDataChannels()
-	s.SetIncludeLoopbackCandidate(true)
-	api := webrtc.NewAPI(webrtc.WithSettingEngine(s))
+	location, err := Find(psk, camp.TURNServers, WithEpoch(o.epoch), WithProtocol(o.protocol), WithClock(o.clock))
+	if err != nil {
+		return nil, fmt.Errorf("find campfire: %w", err)
+	}
+	return joinAt(ctx, camp, location, o)
+}
 
-	iceList, err := camp.GetICEServers()
+// joinAt joins the peer waiting at the given location.
+func joinAt(ctx context.Context, camp *CampfireURI, location *Location, o *options) (*Conn, error) {
+	log := o.logger.With("protocol", "campfire")
+	if !camp.AnyFingerprintAccepted() && len(camp.Fingerprints()) == 0 {
+		return nil, fmt.Errorf("camp URI pins no fingerprint, use %q to accept any waiting peer", AnyFingerprint)
+	}
+	config, err := o.policy.configuration(camp)
 	if err != nil {
 		return nil, err
 	}
-	pc, err := api.NewPeerConnection(webrtc.Configuration{
-		ICEServers: iceList,
-	})
-
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("generate random ID: %w", err)
+	}
+	s, err := o.newSettingEngine(location)
+	if err != nil {
+		return nil, err
+	}
+	fireconn, err := o.newSignaler(ctx, camp, location, id.String())
+	if err != nil {
+		return nil, fmt.Errorf("new campfire client: %w", err)
+	}
+	defer fireconn.Close()
+	api := webrtc.NewAPI(webrtc.WithSettingEngine(s))
+	pc, err := api.NewPeerConnection(config)
 	if err != nil {
 		return nil, fmt.Errorf("create peer connection: %w", err)
 	}
+	var connected bool
+	defer func() {
+		if !connected {
+			// Closing can block on outstanding TURN allocations, which must
+			// not hold up an already cancelled join.
+			go pc.Close()
+		}
+	}()
 	errs := make(chan error, 1)
-	acceptc := make(chan io.ReadWriteCloser)
-	dc, err := pc.CreateDataChannel(string(location.PSK), nil)
+	sendErr := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	acceptc := make(chan datachannel.ReadWriteCloser, 1)
+	// Any data channel opened by the waiting peer is a stream of a Session.
+	streams := make(chan *Conn, streamBacklog)
+	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		queueStream(dc, pc, streams, log)
+	})
+	dc, err := pc.CreateDataChannel(location.DataChannelLabel(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("create data channel: %w", err)
 	}
@@ -53,11 +96,30 @@ func Join(ctx context.Context, camp *CampfireURI) (io.ReadWriteCloser, error) {
 		log.Debug("Data channel opened")
 		rw, err := dc.Detach()
 		if err != nil {
-			errs <- fmt.Errorf("detach data channel: %w", err)
+			sendErr(fmt.Errorf("detach data channel: %w", err))
 			return
 		}
 		acceptc <- rw
 	})
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Debug("Peer connection state change", "state", state.String())
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			sendErr(fmt.Errorf("peer connection state: %s", state.String()))
+		}
+	})
+	// Local candidates are held back until the offer has been sent, so the
+	// waiting peer always learns about the offer first.
+	localCandidates := make(chan webrtc.ICECandidateInit, 64)
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c == nil {
+			return
+		}
+		select {
+		case localCandidates <- c.ToJSON():
+		default:
+			log.Warn("Dropping local ICE candidate", "candidate", c.String())
+		}
+	})
 	offer, err := pc.CreateOffer(nil)
 	if err != nil {
 		return nil, fmt.Errorf("create offer: %w", err)
@@ -67,79 +129,132 @@ func Join(ctx context.Context, camp *CampfireURI) (io.ReadWriteCloser, error) {
 		return nil, fmt.Errorf("set local description: %w", err)
 	}
 	log.Debug("Sending offer", "offer", offer.SDP)
-	err = fireconn.SendOffer(location.LocalUfrag(), location.LocalPwd(), offer)
+	err = fireconn.SendOffer(ctx, CampfireOffer{
+		ID:    id.String(),
+		Ufrag: location.LocalUfrag(),
+		Pwd:   location.LocalPwd(),
+		SDP:   offer,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("send offer: %w", err)
 	}
-	log.Debug("Waiting for answer")
-	*/
-	/*var answer turn.CampfireAnswer
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case err := <-errs:
-		return nil, err
-	case answer = <-fireconn.Answers():
-	}*/
-	/*
-		log.Debug("Received answer", "answer", answer.SDP)
-		err = pc.SetRemoteDescription(answer.SDP)
-		if err != nil {
-			return nil, fmt.Errorf("set remote description: %w", err)
-		}
-		connectedc := make(chan struct{})
-		pc.OnICECandidate(func(c *webrtc.ICECandidate) {
-			if c == nil {
-				return
-			}
+	connectedc := make(chan struct{})
+	defer close(connectedc)
+	go func() {
+		for {
 			select {
 			case <-connectedc:
 				return
-			default:
-			}
-			log.Debug("Sending local ICE candidate", "candidate", c.String())
-			err = fireconn.SendCandidate("", location.LocalUfrag(), location.LocalPwd(), c)
-			if err != nil {
-				errs <- fmt.Errorf("send ice candidate: %w", err)
-				return
-			}
-		})
-		pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
-			log.Debug("Peer connection state change", "state", state.String())
-			if state == webrtc.PeerConnectionStateConnected {
-				close(connectedc)
-			}
-			if state == webrtc.PeerConnectionStateDisconnected || state == webrtc.PeerConnectionStateFailed {
-				errs <- fmt.Errorf("peer connection state: %s", state.String())
-			}
-		})
-		go func() {
-			for {
-				select {
-				case <-ctx.Done():
+			case c := <-localCandidates:
+				log.Debug("Sending local ICE candidate", "candidate", c.Candidate)
+				err := fireconn.SendCandidate(ctx, CampfireCandidate{
+					ID:    id.String(),
+					Ufrag: location.LocalUfrag(),
+					Pwd:   location.LocalPwd(),
+					Cand:  c,
+				})
+				if err != nil {
+					sendErr(fmt.Errorf("send ice candidate: %w", err))
 					return
-				case <-connectedc:
-					return
-				case cand := <-fireconn.Candidates():
-					log.Debug("Received remote ICE candidate", "candidate", cand.Cand)
-					err = pc.AddICECandidate(cand.Cand)
-					if err != nil {
-						errs <- fmt.Errorf("add ice candidate: %w", err)
-						return
-					}
 				}
 			}
-		}()
+		}
+	}()
+
+	log.Debug("Waiting for answer")
+	// Remote candidates may overtake the answer, so they are queued until the
+	// remote description is in place.
+	var pending []webrtc.ICECandidateInit
+	var answered bool
+	for {
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
 		case err := <-fireconn.Errors():
-			return nil, err
+			return nil, fmt.Errorf("campfire client: %w", err)
 		case err := <-errs:
 			return nil, err
+		case answer := <-fireconn.Answers():
+			if answered || answer.ID != id.String() {
+				continue
+			}
+			// Only the waiting peer can derive the remote credentials.
+			if answer.Ufrag != location.RemoteUfrag() || answer.Pwd != location.RemotePwd() {
+				log.Warn("Received answer with unexpected ufrag/pwd", "ufrag", answer.Ufrag)
+				continue
+			}
+			if err := checkCredentials(answer.SDP, location.RemoteUfrag(), location.RemotePwd()); err != nil {
+				log.Warn("Received answer with unexpected ICE credentials", "err", err)
+				continue
+			}
+			// DTLS holds the waiting peer to the fingerprint in its answer, so
+			// pinning the answer pins the peer.
+			fingerprint, err := remoteFingerprint(answer.SDP)
+			if err != nil {
+				return nil, err
+			}
+			if err := camp.VerifyFingerprint(fingerprint); err != nil {
+				return nil, err
+			}
+			log.Debug("Received answer", "answer", answer.SDP.SDP)
+			err = pc.SetRemoteDescription(answer.SDP)
+			if err != nil {
+				return nil, fmt.Errorf("set remote description: %w", err)
+			}
+			answered = true
+			for _, c := range pending {
+				if err := pc.AddICECandidate(c); err != nil {
+					return nil, fmt.Errorf("add ice candidate: %w", err)
+				}
+			}
+			pending = nil
+		case cand := <-fireconn.Candidates():
+			if cand.ID != id.String() || cand.Ufrag != location.RemoteUfrag() || cand.Pwd != location.RemotePwd() {
+				continue
+			}
+			if !o.policy.allowsRemote(cand.Cand.Candidate) {
+				log.Debug("Ignoring remote ICE candidate ruled out by the policy", "candidate", cand.Cand.Candidate)
+				continue
+			}
+			log.Debug("Received remote ICE candidate", "candidate", cand.Cand.Candidate)
+			if !answered {
+				pending = append(pending, cand.Cand)
+				continue
+			}
+			err = pc.AddICECandidate(cand.Cand)
+			if err != nil {
+				return nil, fmt.Errorf("add ice candidate: %w", err)
+			}
 		case rw := <-acceptc:
-			return rw, nil
+			// Check the certificate the waiting peer actually presented.
+			sum := sha256.Sum256(pc.SCTP().Transport().GetRemoteCertificate())
+			if err := camp.VerifyFingerprint(hex.EncodeToString(sum[:])); err != nil {
+				rw.Close()
+				return nil, err
+			}
+			if code, ok := camp.Code(); ok {
+				if err := joinCode(ctx, rw, code, id.String(), pc); err != nil {
+					rw.Close()
+					return nil, err
+				}
+			}
+			connected = true
+			pc.OnICECandidate(nil)
+			return newConn(rw, dc, pc, streams), nil
 		}
-	*/
-	return nil, nil
+	}
+}
+
+// joinCode proves to the waiting peer that the joining peer knows the code of
+// the campfire. It gives up when ctx is done.
+func joinCode(ctx context.Context, rw io.ReadWriter, code, id string, pc *webrtc.PeerConnection) error {
+	joinFingerprint, err := remoteFingerprint(*pc.LocalDescription())
+	if err != nil {
+		return err
+	}
+	waitFingerprint, err := remoteFingerprint(*pc.RemoteDescription())
+	if err != nil {
+		return err
+	}
+	return authenticateCode(ctx, rw, code, id, joinFingerprint, waitFingerprint, true)
 }
@@ -0,0 +1,224 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestJoin(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]func(fingerprint string) string{
+		"pinned": func(fingerprint string) string { return fingerprint },
+		"rotated": func(fingerprint string) string {
+			_, old := newTestCertificate(t)
+			return old + "," + fingerprint
+		},
+		"any": func(string) string { return AnyFingerprint },
+	}
+	for name, host := range tcs {
+		host := host
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			wsServer, _ := setupSignaling(t)
+			cert, fingerprint := newTestCertificate(t)
+			camp, err := ParseCampfireURI("camp://" + host(fingerprint) + "/?0=turn:127.0.0.1:1&1=" + wsServer + "#" + string(MustGeneratePSK()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			location, err := Find([]byte(camp.PSK), camp.TURNServers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fireconn, err := DialSignaler(ctx, wsServer, location, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fireconn.Close()
+
+			// Answer the first offer by hand and greet the joining peer.
+			waitErrs := make(chan error, 1)
+			go func() {
+				waitErrs <- answerOne(ctx, fireconn, location, cert)
+			}()
+
+			conn, err := Join(ctx, camp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			b := make([]byte, 5)
+			n, err := conn.Read(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b[:n]) != "hello" {
+				t.Fatalf("expected 'hello' got %s", string(b[:n]))
+			}
+			if err := <-waitErrs; err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestJoinFingerprintMismatch(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	wsServer, _ := setupSignaling(t)
+	_, fingerprint := newTestCertificate(t)
+	impostor, _ := newTestCertificate(t)
+	camp, err := ParseCampfireURI("camp://" + fingerprint + "/?0=turn:127.0.0.1:1&1=" + wsServer + "#" + string(MustGeneratePSK()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, err := Find([]byte(camp.PSK), camp.TURNServers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fireconn, err := DialSignaler(ctx, wsServer, location, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fireconn.Close()
+	go func() {
+		_ = answerOne(ctx, fireconn, location, impostor)
+	}()
+
+	_, err = Join(ctx, camp)
+	if !errors.Is(err, ErrFingerprintMismatch) {
+		t.Fatalf("expected fingerprint mismatch, got %v", err)
+	}
+}
+
+func TestJoinNoFingerprint(t *testing.T) {
+	t.Parallel()
+	camp, err := ParseCampfireURI("camp:///?0=turn:127.0.0.1:1#" + string(MustGeneratePSK()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Join(context.Background(), camp); err == nil || !strings.Contains(err.Error(), "pins no fingerprint") {
+		t.Fatalf("expected missing fingerprint, got %v", err)
+	}
+}
+
+func TestJoinNoSignalingServer(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	camp, err := ParseCampfireURI("camp://fingerprint/?0=turn:127.0.0.1:1&1=ws://127.0.0.1:1#" + string(MustGeneratePSK()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Join(ctx, camp)
+	if err == nil || !strings.Contains(err.Error(), "no reachable signaling server") {
+		t.Fatalf("expected unreachable signaling servers, got %v", err)
+	}
+}
+
+func TestJoinContextCanceled(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	wsServer, _ := setupSignaling(t)
+	camp, err := ParseCampfireURI("camp://fingerprint/?0=turn:127.0.0.1:1&1=" + wsServer + "#" + string(MustGeneratePSK()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Join(ctx, camp)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func answerOne(ctx context.Context, fireconn Signaler, location *Location, cert *webrtc.Certificate) error {
+	waiting := *location
+	waiting.Waiting = true
+	s := webrtc.SettingEngine{}
+	s.SetIncludeLoopbackCandidate(true)
+	s.SetICECredentials(waiting.LocalUfrag(), waiting.LocalPwd())
+	api := webrtc.NewAPI(webrtc.WithSettingEngine(s))
+	pc, err := api.NewPeerConnection(webrtc.Configuration{
+		Certificates: []webrtc.Certificate{*cert},
+	})
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		dc.OnOpen(func() {
+			defer close(done)
+			_ = dc.SendText("hello")
+		})
+	})
+	var offer CampfireOffer
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case offer = <-fireconn.Offers():
+	}
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c == nil {
+			return
+		}
+		_ = fireconn.SendCandidate(ctx, CampfireCandidate{
+			ID:    offer.ID,
+			Ufrag: waiting.LocalUfrag(),
+			Pwd:   waiting.LocalPwd(),
+			Cand:  c.ToJSON(),
+		})
+	})
+	if err := pc.SetRemoteDescription(offer.SDP); err != nil {
+		return err
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return err
+	}
+	if err := pc.SetLocalDescription(answer); err != nil {
+		return err
+	}
+	if err := fireconn.SendAnswer(ctx, CampfireAnswer{
+		ID:    offer.ID,
+		Ufrag: waiting.LocalUfrag(),
+		Pwd:   waiting.LocalPwd(),
+		SDP:   answer,
+	}); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-done:
+			// Leave the peer connection open for the joiner to read.
+			go func() {
+				<-ctx.Done()
+				pc.Close()
+			}()
+			return nil
+		case cand := <-fireconn.Candidates():
+			if err := pc.AddICECandidate(cand.Cand); err != nil {
+				return err
+			}
+		}
+	}
+}
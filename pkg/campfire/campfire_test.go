@@ -8,26 +8,41 @@
 package campfire
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/pion/webrtc/v3"
+
+	"campfire/pkg/campfire/rendezvous"
+	"campfire/pkg/campfire/turnserver"
 )
 
 func TestCampfire(t *testing.T) {
-	var nilCert *webrtc.Certificate
 	t.Parallel()
 
 	ctx := context.Background()
 	turnAddr := setupTest(t)
-	campURI := fmt.Sprintf("camp://fingerprint/?0=9d4e8faba9a93ef397554dc4:hLxK4U49l6fcZLH0@%s#abcdefghijklmnopqrstuvwx12345678", turnAddr)
+	cert, fingerprint := newTestCertificate(t)
+	campURI := fmt.Sprintf("camp://%s/?0=9d4e8faba9a93ef397554dc4:hLxK4U49l6fcZLH0@%s#abcdefghijklmnopqrstuvwx12345678", fingerprint, turnAddr)
 	ourcamp, err := ParseCampfireURI(campURI)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	cf, err := ourcamp.Wait(ctx, nilCert)
+	cf, err := ourcamp.Wait(ctx, WithCertificate(cert))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -80,12 +95,89 @@ func TestCampfire(t *testing.T) {
 	}
 }
 
+// TestPSKNotLeaked checks that the PSK never appears in the SDP, signaling
+// messages or data channel labels of a campfire.
+func TestPSKNotLeaked(t *testing.T) {
+	t.Parallel()
+	for _, version := range []string{"1", "2"} {
+		version := version
+		t.Run("v"+version, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			// Record everything the peers send to the signaling server.
+			var mu sync.Mutex
+			var sent [][]byte
+			handler := rendezvous.NewHandler(rendezvous.NewHub())
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				mu.Lock()
+				sent = append(sent, []byte(r.URL.String()), body)
+				mu.Unlock()
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				handler.ServeHTTP(w, r)
+			}))
+			t.Cleanup(server.Close)
+
+			cert, fingerprint := newTestCertificate(t)
+			psk := MustGeneratePSK()
+			camp, err := ParseCampfireURI("camp://" + fingerprint + "/?v=" + version + "&0=turn:127.0.0.1:1&1=" + server.URL + "#" + string(psk))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cf, err := camp.Wait(ctx, WithCertificate(cert))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cf.Close()
+			go func() {
+				if conn, err := cf.Accept(); err == nil {
+					_, _ = conn.Write([]byte("hello"))
+				}
+			}()
+			conn, err := Join(ctx, camp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if _, err := conn.Read(make([]byte, 5)); err != nil {
+				t.Fatal(err)
+			}
+
+			campOpts, err := camp.options()
+			if err != nil {
+				t.Fatal(err)
+			}
+			location, err := Find(psk, camp.TURNServers, campOpts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, b := range append(sent, []byte(location.DataChannelLabel())) {
+				for _, encoded := range []string{
+					string(psk),
+					base64.StdEncoding.EncodeToString(psk),
+					base64.RawStdEncoding.EncodeToString(psk),
+					hex.EncodeToString(psk),
+				} {
+					if bytes.Contains(b, []byte(encoded)) {
+						t.Fatalf("PSK leaked in %q", b)
+					}
+				}
+			}
+		})
+	}
+}
+
 func setupTest(t *testing.T) (turnServer string) {
 	t.Helper()
-	/*server, err := turn.NewServer(&turn.Options{
+	server, err := turnserver.NewServer(&turnserver.Options{
 		PublicIP:        "127.0.0.1",
 		RelayAddressUDP: "0.0.0.0",
 		ListenUDP:       ":0",
+		Users:           map[string]string{"9d4e8faba9a93ef397554dc4": "hLxK4U49l6fcZLH0"},
 		EnableCampfire:  true,
 	})
 	if err != nil {
@@ -93,6 +185,117 @@ func setupTest(t *testing.T) (turnServer string) {
 	}
 	t.Cleanup(func() {
 		server.Close()
-	})*/
-	return "" //fmt.Sprintf("127.0.0.1:%d", server.ListenPort())
+	})
+	return fmt.Sprintf("127.0.0.1:%d", server.ListenPort())
+}
+
+func TestCampfireOffer(t *testing.T) {
+	cert, fingerprint := newTestCertificate(t)
+	camp, err := ParseCampfireURI("camp://" + fingerprint + "/?0=turn:127.0.0.1:1#" + string(MustGeneratePSK()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	builders := map[string]func(bool, *webrtc.Certificate) (*webrtc.SessionDescription, error){
+		"CampfireOffer":       camp.CampfireOffer,
+		"CampfireOfferStruct": camp.CampfireOfferStruct,
+	}
+	want, err := sdpCertificateFingerprint(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if normalizeFingerprint(want) != fingerprint {
+		t.Fatalf("expected fingerprint %s, got %s", fingerprint, want)
+	}
+	for name, build := range builders {
+		desc, err := build(false, cert)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !strings.Contains(desc.SDP, "a=fingerprint:sha-256 "+want+"\r\n") {
+			t.Fatalf("%s: expected fingerprint %s in %q", name, want, desc.SDP)
+		}
+	}
+}
+
+// newTestCertificate returns a new DTLS certificate and its fingerprint.
+func newTestCertificate(t *testing.T) (*webrtc.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := webrtc.GenerateCertificate(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := CertificateFingerprint(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, fingerprint
+}
+
+// newTestCamp returns a camp URI that pins a new certificate and signals
+// through a new rendezvous server. args are prepended to its query, e.g.
+// "maxpeers=1&".
+func newTestCamp(t *testing.T, args string) (*CampfireURI, *webrtc.Certificate) {
+	t.Helper()
+	_, httpServer := setupSignaling(t)
+	cert, fingerprint := newTestCertificate(t)
+	camp, err := ParseCampfireURI("camp://" + fingerprint + "/?" + args + "0=turn:127.0.0.1:1&1=" + httpServer + "#" + string(MustGeneratePSK()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return camp, cert
+}
+
+// connectTestCampfire waits at a campfire of newTestCamp and joins it, both
+// with opts. It returns the campfire and both ends of the connection, which
+// are closed when the test ends.
+func connectTestCampfire(ctx context.Context, t *testing.T, args string, opts ...Option) (*CampfireURI, CampfireChannel, *Peer, *Conn) {
+	t.Helper()
+	camp, cert := newTestCamp(t, args)
+	cf, err := camp.Wait(ctx, append([]Option{WithCertificate(cert)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cf.Close() })
+	peer, conn := joinTestCampfire(ctx, t, camp, cf, opts...)
+	return camp, cf, peer, conn
+}
+
+// joinTestCampfire joins the campfire with opts and returns the peer it
+// accepted and the joined connection, which are closed when the test ends.
+func joinTestCampfire(ctx context.Context, t *testing.T, camp *CampfireURI, cf CampfireChannel, opts ...Option) (*Peer, *Conn) {
+	t.Helper()
+	accepted := make(chan *Peer, 1)
+	go func() {
+		peer, _ := cf.Accept()
+		accepted <- peer
+	}()
+	conn, err := Join(ctx, camp, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	var peer *Peer
+	select {
+	case peer = <-accepted:
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+	if peer == nil {
+		t.Fatal("expected the campfire to accept the joining peer")
+	}
+	t.Cleanup(func() { peer.Close() })
+	return peer, conn
+}
+
+// setupSignaling starts a rendezvous server and returns its WebSocket and
+// HTTP URLs.
+func setupSignaling(t *testing.T) (wsServer, httpServer string) {
+	t.Helper()
+	server := httptest.NewServer(rendezvous.NewHandler(rendezvous.NewHub()))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http"), server.URL
 }
@@ -17,9 +17,12 @@ limitations under the License.
 package campfire
 
 import (
+	"errors"
+	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pion/webrtc/v3"
 )
@@ -27,14 +30,20 @@ import (
 const (
 	defaultStunHost = "stun.l.google.com"
 	defaultStunPort = "19302"
-	defaultTurnHost = "a.relay.metered.ca"
-	defaultTurnPort = "443"
-	defaultTurnUser = "9d4e8faba9a93ef397554dc4"
-	defaultTurnCred = "hLxK4U49l6fcZLH0"
 )
 
+// AnyFingerprint is the camp URI host of a campfire that accepts any waiting
+// peer, trusting whoever holds the pre-shared key.
+const AnyFingerprint = "any"
+
+// ErrFingerprintMismatch is returned when the certificate of the waiting peer
+// does not match any fingerprint pinned by the camp URI.
+var ErrFingerprintMismatch = errors.New("certificate fingerprint mismatch")
+
 // CampfireURI represents the components camp from a camp URL.
 type CampfireURI struct {
+	// PublicKeyFingerprint is a comma separated list of the SHA-256
+	// fingerprints accepted for the waiting peer, or AnyFingerprint.
 	PublicKeyFingerprint string
 	FullPath             string
 	Arguments            string
@@ -87,11 +96,32 @@ func ParseCampfireURI(rawURL string) (*CampfireURI, error) {
 			campURL.WebsocketServers = append(campURL.WebsocketServers, decodedServerURL)
 		case strings.HasPrefix(lowerServerURL, "http://") || strings.HasPrefix(lowerServerURL, "https://"):
 			campURL.HTTPServers = append(campURL.HTTPServers, decodedServerURL)
+		case strings.Contains(decodedServerURL, "@"):
+			// Credentials without a scheme are a TURN server.
+			campURL.TURNServers = append(campURL.TURNServers, decodedServerURL)
 		}
 	}
 
 	// Any query params that are not numeric are stored:
 	campURL.Arguments = queryParams.Encode()
+	if _, err := campURL.Epoch(); err != nil {
+		return nil, err
+	}
+	if _, err := campURL.Version(); err != nil {
+		return nil, err
+	}
+	if _, err := campURL.KDFParams(); err != nil {
+		return nil, err
+	}
+	if _, err := campURL.MaxPeers(); err != nil {
+		return nil, err
+	}
+	if _, err := campURL.Policy(); err != nil {
+		return nil, err
+	}
+	if pake := queryParams.Get("pake"); pake != "" && pake != pakeCPace {
+		return nil, fmt.Errorf("unsupported pake %q", pake)
+	}
 
 	if len(u.Fragment) > 0 {
 		campURL.PSK = u.Fragment
@@ -122,19 +152,14 @@ func (camp *CampfireURI) EncodeURI() string {
 		i++
 	}
 
-	// We need atleast one connection canidate.
-	if i == 0 && defaultTurnHost != "" {
-		queryParams.Add(strconv.Itoa(i), "turn:"+defaultTurnUser+":"+defaultTurnCred+"@"+defaultTurnHost)
-	}
-
 	query := camp.Arguments
 
 	// If it isn't empty we need to allow for more params:
 	if query != "" {
 		query += "&"
 	}
-	// Add the query Arguments:
-	query += queryParams.Encode()
+	// Add the query Arguments, keeping the server URLs readable:
+	query += serverEscaper.Replace(queryParams.Encode())
 
 	u := url.URL{
 		Scheme:   "camp",
@@ -147,6 +172,173 @@ func (camp *CampfireURI) EncodeURI() string {
 	return u.String()
 }
 
+// Epoch returns the lifetime of the campfire's locations, set by the "ttl"
+// argument of the camp URI, e.g. ttl=10m. It defaults to DefaultEpoch.
+func (camp *CampfireURI) Epoch() (time.Duration, error) {
+	args, err := url.ParseQuery(camp.Arguments)
+	if err != nil {
+		return 0, err
+	}
+	ttl := args.Get("ttl")
+	if ttl == "" {
+		return DefaultEpoch, nil
+	}
+	epoch, err := time.ParseDuration(ttl)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl: %w", err)
+	}
+	if epoch < MinEpoch {
+		return 0, fmt.Errorf("invalid ttl: must be at least %s", MinEpoch)
+	}
+	return epoch, nil
+}
+
+// Version returns the protocol version of the campfire, set by the "v"
+// argument of the camp URI. v=1 selects ProtocolV1 for interop with older
+// peers. It defaults to Protocol.
+func (camp *CampfireURI) Version() (string, error) {
+	args, err := url.ParseQuery(camp.Arguments)
+	if err != nil {
+		return "", err
+	}
+	switch v := args.Get("v"); v {
+	case "":
+		return Protocol, nil
+	case "1":
+		return ProtocolV1, nil
+	case "2":
+		return ProtocolV2, nil
+	default:
+		return "", fmt.Errorf("unsupported protocol version %q", v)
+	}
+}
+
+// KDFParams returns the parameters passphrases are stretched with, set by
+// the "kdf" argument of the camp URI. It defaults to DefaultKDFParams.
+func (camp *CampfireURI) KDFParams() (KDFParams, error) {
+	args, err := url.ParseQuery(camp.Arguments)
+	if err != nil {
+		return KDFParams{}, err
+	}
+	kdf := args.Get("kdf")
+	if kdf == "" {
+		return DefaultKDFParams, nil
+	}
+	return ParseKDFParams(kdf)
+}
+
+// MaxPeers returns how many peers the waiting peer is connected to at once,
+// set by the "maxpeers" argument of the camp URI. Zero means no limit.
+func (camp *CampfireURI) MaxPeers() (int, error) {
+	args, err := url.ParseQuery(camp.Arguments)
+	if err != nil {
+		return 0, err
+	}
+	maxPeers := args.Get("maxpeers")
+	if maxPeers == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(maxPeers)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid maxpeers %q", maxPeers)
+	}
+	return n, nil
+}
+
+// Policy returns the paths peers of the campfire connect over, set by the
+// "policy" argument of the camp URI, e.g. policy=relay. It defaults to
+// PolicyAll.
+func (camp *CampfireURI) Policy() (Policy, error) {
+	args, err := url.ParseQuery(camp.Arguments)
+	if err != nil {
+		return "", err
+	}
+	return ParsePolicy(args.Get("policy"))
+}
+
+// Key returns the PSK the campfire is found with. A PSK of PSKSize bytes is
+// used as is unless the camp URI sets a "kdf", any other PSK is a passphrase
+// that is stretched into one. Campfires met with a code are found by the
+// nameplate of the code alone.
+func (camp *CampfireURI) Key() ([]byte, error) {
+	args, err := url.ParseQuery(camp.Arguments)
+	if err != nil {
+		return nil, err
+	}
+	if code, ok := camp.Code(); ok {
+		nameplate, err := parseCode(code)
+		if err != nil {
+			return nil, err
+		}
+		return nameplateKey(nameplate), nil
+	}
+	if len(camp.PSK) == PSKSize && args.Get("kdf") == "" {
+		return []byte(camp.PSK), nil
+	}
+	params, err := camp.KDFParams()
+	if err != nil {
+		return nil, err
+	}
+	return StretchPSK([]byte(camp.PSK), params)
+}
+
+// options returns the options the camp URI sets for both peers.
+func (camp *CampfireURI) options() ([]Option, error) {
+	epoch, err := camp.Epoch()
+	if err != nil {
+		return nil, err
+	}
+	version, err := camp.Version()
+	if err != nil {
+		return nil, err
+	}
+	policy, err := camp.Policy()
+	if err != nil {
+		return nil, err
+	}
+	return []Option{WithEpoch(epoch), WithProtocol(version), WithPolicy(policy)}, nil
+}
+
+// AnyFingerprintAccepted returns true if the campfire accepts any waiting
+// peer.
+func (camp *CampfireURI) AnyFingerprintAccepted() bool {
+	return strings.EqualFold(camp.PublicKeyFingerprint, AnyFingerprint)
+}
+
+// Fingerprints returns the fingerprints accepted for the waiting peer in the
+// form returned by CertificateFingerprint.
+func (camp *CampfireURI) Fingerprints() []string {
+	if camp.AnyFingerprintAccepted() {
+		return nil
+	}
+	var fingerprints []string
+	for _, fingerprint := range strings.Split(camp.PublicKeyFingerprint, ",") {
+		if fingerprint = strings.TrimSpace(fingerprint); fingerprint != "" {
+			fingerprints = append(fingerprints, normalizeFingerprint(fingerprint))
+		}
+	}
+	return fingerprints
+}
+
+// VerifyFingerprint returns ErrFingerprintMismatch unless the fingerprint is
+// accepted for the waiting peer.
+func (camp *CampfireURI) VerifyFingerprint(fingerprint string) error {
+	if camp.AnyFingerprintAccepted() {
+		return nil
+	}
+	fingerprint = normalizeFingerprint(fingerprint)
+	for _, accepted := range camp.Fingerprints() {
+		if accepted == fingerprint {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not pinned by the campfire", ErrFingerprintMismatch, fingerprint)
+}
+
+// serverEscaper undoes the escaping of characters that are allowed
+// unescaped in a query and are common in server URLs.
+var serverEscaper = strings.NewReplacer("%3A", ":", "%40", "@", "%2F", "/")
+
 func parseTurnURL(turnURL string) (*webrtc.ICEServer, error) {
 	serverURL := turnURL
 	parts := strings.SplitN(turnURL, "@", 2)
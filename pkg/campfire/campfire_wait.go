@@ -9,198 +9,328 @@ package campfire
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
-	"net"
-	"strings"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/pion/webrtc/v3"
 )
 
-// Wait will wait for peers to join at the given location.
-func (camp *CampfireURI) Wait(ctx context.Context, cert *webrtc.Certificate) (CampfireChannel, error) {
-
-	iceList, err := camp.GetICEServers()
+// Wait will wait for peers to join at the given location. Joining peers only
+// accept the certificates pinned by the host of the camp URI, so the
+// certificate set with WithCertificate must match one of them unless the
+// campfire accepts any fingerprint, and Wait fails without one.
+//
+// Around an epoch boundary the campfire also listens at the adjacent epoch
+// for the grace period set with WithGracePeriod, so peers with skewed clocks
+// still meet. Epochs last as long as the "ttl" argument of the camp URI
+// says. The campfire expires once the grace period after the current
+// epoch has passed.
+//
+// Peers beyond the limits set with WithMaxHandshakes and WithMaxPeers are
+// turned away and reported as EventPeerRejected events. Peers only connect
+// over the paths allowed by the policy set with WithPolicy or the "policy"
+// argument of the camp URI.
+func (camp *CampfireURI) Wait(ctx context.Context, opts ...Option) (CampfireChannel, error) {
+	campOpts, err := camp.options()
 	if err != nil {
-		return nil, fmt.Errorf("No locations: %w", err)
+		return nil, err
 	}
-	//log.Debug("Found campfire location", "location", iceList)
+	maxPeers, err := camp.MaxPeers()
 	if err != nil {
-		return nil, fmt.Errorf("new campfire client: %w", err)
-	}
-
-	s := webrtc.SettingEngine{}
-	s.SetICECredentials("fKVhbscsMWDGAnBg", "xGjQkAvKIVkBeVTGWcvCQtnVAeapczwa")
-	var peerConnection *webrtc.PeerConnection
-	if cert != nil {
-		peerConnection, err = webrtc.NewPeerConnection(webrtc.Configuration{
-			ICEServers:   iceList,
-			Certificates: []webrtc.Certificate{*cert},
-		})
-	} else {
-		peerConnection, err = webrtc.NewPeerConnection(webrtc.Configuration{
-			ICEServers: iceList,
-		})
+		return nil, err
 	}
-	if err != nil {
-		return nil, fmt.Errorf("bad peer connection: %w", err)
+	campOpts = append(campOpts, WithMaxPeers(maxPeers))
+	o := newOptions(append(campOpts, opts...))
+	log := o.logger.With("protocol", "campfire", "component", "campfire-wait")
+	cert := o.certificate
+	if cert == nil && !camp.AnyFingerprintAccepted() && len(camp.Fingerprints()) > 0 {
+		return nil, errors.New("camp URI pins fingerprints, set the matching certificate with WithCertificate")
 	}
-	if len(camp.TURNServers) > 0 {
-		turnHost, err := extractHostname(camp.TURNServers[0])
+	if cert != nil {
+		fingerprint, err := CertificateFingerprint(cert)
 		if err != nil {
-			return nil, fmt.Errorf("bad turn host: %w", err)
+			return nil, err
 		}
-		addr, err := net.LookupIP(turnHost)
-		if err != nil {
-			return nil, fmt.Errorf("lookup failed: %w", err)
+		if err := camp.VerifyFingerprint(fingerprint); err != nil {
+			return nil, err
 		}
-
-		// Create a TURN relay ICE candidate with no remote IP
-		iceCandidate := webrtc.ICECandidateInit{
-			Candidate: "candidate:0 1 UDP 2130706431 " + addr[0].String() + " 3478 typ relay",
-		}
-		// Add the TURN relay ICE candidate to the peer connection
-		err = peerConnection.AddICECandidate(iceCandidate)
 	}
-	if len(camp.STUNServers) > 0 {
-		// todo add STUN canidates if they exist
+	if _, err := o.policy.configuration(camp); err != nil {
+		return nil, err
 	}
-
+	psk, err := camp.Key()
 	if err != nil {
-		fmt.Println("Error adding ICE candidate:", err)
+		return nil, err
 	}
-	/*
-		peerConnection.OnICEConnectionStateChange(func(connectionState webrtc.ICEConnectionState) {
-			fmt.Printf("Connection State has changed %s \n", connectionState.String())
-		})
-	*/
-	/*
-		localOffer, err := camp.CampfireOffer(true)
-		if err != nil {
-			return nil, fmt.Errorf("bad offers: %w", err)
+	candidates, err := FindCandidates(psk, camp.TURNServers, WithEpoch(o.epoch), WithProtocol(o.protocol), WithClock(o.clock))
+	if err != nil {
+		return nil, fmt.Errorf("find campfire: %w", err)
+	}
+	current := candidates[1]
+	t := &turnWait{
+		camp:                    camp,
+		opts:                    o,
+		expiresAt:               current.ExpiresAt.Add(o.gracePeriod),
+		acceptc:                 make(chan *Peer),
+		peers:                   make(map[string]*Peer),
+		handshakes:              make(map[string]map[string]bool),
+		maxHandshakes:           o.maxHandshakes,
+		maxHandshakesPerAddress: o.maxHandshakesPerAddress,
+		maxPeers:                o.maxPeers,
+		singleUse:               o.singleUse,
+		closec:                  make(chan struct{}),
+		errc:                    make(chan error, 10),
+		events:                  make(chan Event, maxPendingEvents),
+		authorizer:              o.authorizer,
+		inProgress:              make(map[string]*webrtc.PeerConnection),
+		pending:                 make(map[string][]webrtc.ICECandidateInit),
+		log:                     log,
+	}
+	// The context of the authorizer ends with the campfire.
+	var cancel context.CancelFunc
+	t.ctx, cancel = context.WithCancel(ctx)
+	if cert != nil {
+		t.SetCertificatefromX509(*cert)
+	}
+	now := o.clock.Now()
+	for _, location := range candidates {
+		opensAt := location.StartsAt.Add(-o.gracePeriod)
+		closesAt := location.ExpiresAt.Add(o.gracePeriod)
+		switch {
+		case !now.Before(closesAt) || !opensAt.Before(t.expiresAt):
+			// The epoch is out of reach of the grace period.
+		case now.Before(opensAt):
+			go t.listenAt(ctx, location, opensAt, closesAt)
+		default:
+			fire, err := t.listen(ctx, location)
+			if err != nil {
+				t.Close()
+				cancel()
+				return nil, err
+			}
+			go t.closeAt(fire, closesAt)
 		}
+	}
+	go func() {
+		defer cancel()
+		select {
+		case <-ctx.Done():
+			t.Close()
+		case <-t.closec:
+		}
+	}()
+	return t, nil
+}
 
-		err = peerConnection.SetLocalDescription(*localOffer)
+const (
+	// maxPendingCandidates is the number of candidates held for an offer
+	// whose peer connection is not ready yet.
+	maxPendingCandidates = 64
+	// maxPendingOffers is the number of offers candidates are held for.
+	maxPendingOffers = 64
+)
 
-	*/
+type turnWait struct {
+	camp      *CampfireURI
+	opts      *options
+	expiresAt time.Time
+	fires     []*waitFire
+	acceptc   chan *Peer
+	peers     map[string]*Peer
+	// handshakes holds the addresses of the candidates of the offers that
+	// are admitted but not connected yet.
+	handshakes              map[string]map[string]bool
+	maxHandshakes           int
+	maxHandshakesPerAddress int
+	maxPeers                int
+	singleUse               bool
+	closec                  chan struct{}
+	closeOnce               sync.Once
+	errc                    chan error
+	events                  chan Event
+	authorizer              Authorizer
+	ctx                     context.Context
+	// inProgress holds the peer connections of the handshakes, which are
+	// closed with the campfire.
+	inProgress map[string]*webrtc.PeerConnection
+	pending    map[string][]webrtc.ICECandidateInit
+	// handoffs counts the added peers not handed to Accept yet.
+	handoffs int
+	// draining is set once the campfire takes no more offers, and drained
+	// is closed when its last handshake is done.
+	draining     bool
+	drained      chan struct{}
+	log          *slog.Logger
+	mu           sync.Mutex
+	certificates []webrtc.Certificate
+}
 
-	// Create a data channel (optional)
-	/*
-		dataChannel, err := peerConnection.CreateDataChannel("data", nil)
-		if err != nil {
-			panic(err)
-		}
-	*/
-	// Create an offer
-	offer, err := peerConnection.CreateOffer(nil)
-	if err != nil {
-		panic(err)
-	}
+// waitFire is the campfire of a single epoch the waiting peer listens at.
+type waitFire struct {
+	api      *webrtc.API
+	location *Location
+	fireconn Signaler
+	closec   chan struct{}
+}
 
-	localOffer, err := camp.CampfireOffer(true)
+// listen starts listening at the given location.
+func (t *turnWait) listen(ctx context.Context, location *Location) (*waitFire, error) {
+	location.Waiting = true
+	t.log.Debug("Found campfire location", "turn-server", location.TURNServer, "epoch", location.StartsAt)
+	s, err := t.opts.newSettingEngine(location)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	// Set local description
-	err = peerConnection.SetLocalDescription(*localOffer)
+	fireconn, err := t.opts.newSignaler(ctx, t.camp, location, "")
 	if err != nil {
-		fmt.Println(offer.SDP)
-		//log.Debug(offer.SDP)
-		panic(err)
+		return nil, fmt.Errorf("new campfire client: %w", err)
 	}
-
-	/*
-		if err != nil {
-			return nil, fmt.Errorf("local offer: %w\n%s", err, localOffer.SDP)
-		}
-	*/
-	remoteOffer, err := camp.CampfireOffer(false)
-	if err != nil {
-		return nil, fmt.Errorf("remote description error: %w,\n%s", err, remoteOffer)
+	fire := &waitFire{
+		api:      webrtc.NewAPI(webrtc.WithSettingEngine(s)),
+		location: location,
+		fireconn: fireconn,
+		closec:   make(chan struct{}),
 	}
-	err = peerConnection.SetRemoteDescription(*remoteOffer)
-
-	if err != nil {
-		return nil, fmt.Errorf("remote description error: %w,\n%s", err, remoteOffer.SDP)
+	t.mu.Lock()
+	if !t.Opened() {
+		t.mu.Unlock()
+		fireconn.Close()
+		return nil, ErrClosed
 	}
-	// todo - I belive we need to diable this repaly protection:
-	s.DisableSRTCPReplayProtection(false)
-	s.DetachDataChannels()
-	s.SetIncludeLoopbackCandidate(true)
-
-	peerConnection.OnDataChannel(func(d *webrtc.DataChannel) {
-		d.OnOpen(func() {
-			fmt.Printf("DataChannel %s has opened \n", d.Label())
-		})
-
-		d.OnMessage(func(m webrtc.DataChannelMessage) {
-			fmt.Printf("%s \n", m.Data)
-		})
-	})
-
-	select {}
-	return nil, nil
+	t.fires = append(t.fires, fire)
+	t.mu.Unlock()
+	go t.handleIncomingOffers(fire)
+	go t.handleIncomingCandidates(fire)
+	return fire, nil
 }
 
-func extractHostname(connectionURL string) (string, error) {
-	// Find the position of the first ":" to identify the prefix
-	prefixEnd := strings.Index(connectionURL, ":")
-
-	// Extract the hostname part based on the prefix position
-	if prefixEnd == -1 {
-		return "", fmt.Errorf("Invalid connection URL")
+// listenAt listens at the given location between opensAt and closesAt.
+func (t *turnWait) listenAt(ctx context.Context, location *Location, opensAt, closesAt time.Time) {
+	clock := t.opts.clock
+	timer := clock.NewTimer(opensAt.Sub(clock.Now()))
+	defer timer.Stop()
+	select {
+	case <-t.closec:
+		return
+	case <-timer.C():
 	}
-
-	hostnamePart := connectionURL[prefixEnd+1:]
-
-	// Remove any leading "//" after the prefix
-	hostnamePart = strings.TrimPrefix(hostnamePart, "//")
-
-	// Split by "@" to separate username:password and hostname
-	parts := strings.SplitN(hostnamePart, "@", 2)
-	hostnamePart = parts[len(parts)-1]
-
-	// Split by ":" to handle hostname and optional port
-	hostnameAndPort := strings.SplitN(hostnamePart, ":", 2)
-	hostname := hostnameAndPort[0]
-
-	return hostname, nil
+	fire, err := t.listen(ctx, location)
+	if err != nil {
+		if t.Opened() {
+			t.sendErr(err)
+		}
+		return
+	}
+	t.closeAt(fire, closesAt)
 }
 
-type turnWait struct {
-	api      *webrtc.API
-	camp     *CampfireURI
-	location *Location
-	//fireconn     *turn.CampfireClient
-	acceptc      chan io.ReadWriteCloser
-	closec       chan struct{}
-	errc         chan error
-	inProgress   map[string]*webrtc.PeerConnection
-	log          *slog.Logger
-	mu           sync.Mutex
-	certificates []webrtc.Certificate
+// closeAt stops listening at the campfire of an epoch at the given time.
+func (t *turnWait) closeAt(fire *waitFire, closesAt time.Time) {
+	clock := t.opts.clock
+	timer := clock.NewTimer(closesAt.Sub(clock.Now()))
+	defer timer.Stop()
+	select {
+	case <-t.closec:
+		return
+	case <-timer.C():
+	}
+	t.mu.Lock()
+	for i, f := range t.fires {
+		if f == fire {
+			t.fires = append(t.fires[:i], t.fires[i+1:]...)
+			break
+		}
+	}
+	t.mu.Unlock()
+	close(fire.closec)
+	if err := fire.fireconn.Close(); err != nil {
+		t.log.Warn("failed to close campfire client", "err", err)
+	}
 }
 
 // Accept returns a connection to a peer.
-func (t *turnWait) Accept() (io.ReadWriteCloser, error) {
+func (t *turnWait) Accept() (*Peer, error) {
 	select {
 	case <-t.closec:
 		return nil, ErrClosed
 	case conn := <-t.acceptc:
+		if t.singleUse {
+			t.Close()
+		}
 		return conn, nil
 	}
 }
 
-/*
+// Peers returns the peers that are connected, ordered by when they connected.
+func (t *turnWait) Peers() []*Peer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	peers := make([]*Peer, 0, len(t.peers))
+	for _, peer := range t.peers {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].ConnectedAt.Before(peers[j].ConnectedAt)
+	})
+	return peers
+}
+
+// addPeer lists the peer among the connected peers until its connection
+// closes, or returns ErrTooManyPeers if the campfire takes no more peers. The
+// handshake of the peer is released in the same step, so concurrent
+// handshakes cannot both take the last place.
+func (t *turnWait) addPeer(peer *Peer) error {
+	t.mu.Lock()
+	if t.maxPeers > 0 && len(t.peers) >= t.maxPeers {
+		t.mu.Unlock()
+		return ErrTooManyPeers
+	}
+	t.peers[peer.ID] = peer
+	t.handoffs++
+	delete(t.inProgress, peer.ID)
+	delete(t.pending, peer.ID)
+	delete(t.handshakes, peer.ID)
+	t.mu.Unlock()
+	t.sendEvent(Event{Type: EventPeerConnected, Peer: peer.PeerInfo})
+	go func() {
+		<-peer.done
+		t.mu.Lock()
+		delete(t.peers, peer.ID)
+		t.mu.Unlock()
+		t.sendEvent(Event{Type: EventPeerDisconnected, Peer: peer.PeerInfo})
+	}()
+	return nil
+}
+
 // Close closes the camp fire.
 func (t *turnWait) Close() error {
-	close(t.closec)
-	return t.Close()
+	var err error
+	t.closeOnce.Do(func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		close(t.closec)
+		var errs []error
+		for _, fire := range t.fires {
+			errs = append(errs, fire.fireconn.Close())
+		}
+		t.fires = nil
+		err = errors.Join(errs...)
+		for id, pc := range t.inProgress {
+			if pcErr := pc.Close(); pcErr != nil {
+				t.log.Warn("failed to close peer connection", "id", id, "err", pcErr)
+			}
+			delete(t.inProgress, id)
+		}
+		t.pending = make(map[string][]webrtc.ICECandidateInit)
+	})
+	return err
 }
-*/
+
 // Opened returns true if the camp fire is opened.
 func (t *turnWait) Opened() bool {
 	select {
@@ -216,36 +346,80 @@ func (t *turnWait) Errors() <-chan error { return t.errc }
 
 // Expired returns a channel that is closed when the camp fire expires.
 func (t *turnWait) Expired() <-chan struct{} {
+	clock := t.opts.clock
 	ch := make(chan struct{})
 	go func() {
 		defer close(ch)
 		select {
 		case <-t.closec:
-		case <-time.After(time.Until(t.location.ExpiresAt)):
+		case <-clock.After(t.expiresAt.Sub(clock.Now())):
 		}
 	}()
 	return ch
 }
 
-/*
-	func (t *turnWait) handleIncomingOffers() {
-		offers := t.fireconn.Offers()
-		for {
-			select {
-			case <-t.closec:
-				return
-			case err := <-t.fireconn.Errors():
-				t.errc <- fmt.Errorf("campfire client: %w", err)
-			case offer := <-offers:
-				if offer.Ufrag != t.location.RemoteUfrag() || offer.Pwd != t.location.RemotePwd() {
-					t.log.Warn("received offer with unexpected ufrag/pwd", "ufrag", offer.Ufrag, "pwd", offer.Pwd)
-					continue
-				}
-				go t.handleNewPeerConnection(&offer)
+// Events returns a channel of the events of the peers.
+func (t *turnWait) Events() <-chan Event { return t.events }
+
+// sendEvent reports an event without blocking when nobody is listening.
+func (t *turnWait) sendEvent(e Event) {
+	e.Time = t.opts.clock.Now()
+	select {
+	case t.events <- e:
+	default:
+		t.log.Debug("dropping campfire event", "event", e.Type.String())
+	}
+}
+
+// sendErr reports an error without blocking when nobody is listening.
+func (t *turnWait) sendErr(err error) {
+	select {
+	case t.errc <- err:
+	default:
+		t.log.Error("dropping campfire error", "err", err)
+	}
+}
+
+func (t *turnWait) handleIncomingOffers(fire *waitFire) {
+	offers := fire.fireconn.Offers()
+	for {
+		select {
+		case <-t.closec:
+			return
+		case <-fire.closec:
+			return
+		case err := <-fire.fireconn.Errors():
+			t.sendErr(fmt.Errorf("campfire client: %w", err))
+		case offer := <-offers:
+			// Joining peers identify with the remote credentials of the location.
+			err := checkCredentials(offer.SDP, fire.location.RemoteUfrag(), fire.location.RemotePwd())
+			if offer.Ufrag != fire.location.RemoteUfrag() || offer.Pwd != fire.location.RemotePwd() {
+				err = ErrInvalidCredentials
+			}
+			if err != nil {
+				t.log.Warn("received offer with unexpected ICE credentials", "id", offer.ID, "ufrag", offer.Ufrag, "err", err)
+				t.mu.Lock()
+				delete(t.pending, offer.ID)
+				t.mu.Unlock()
+				continue
 			}
+			t.mu.Lock()
+			draining := t.draining
+			t.mu.Unlock()
+			if draining {
+				// The next campfire answers the offer.
+				t.log.Debug("Ignoring offer while draining", "id", offer.ID)
+				continue
+			}
+			if err := t.admit(offer.ID); err != nil {
+				t.reject(offer.ID, nil, err)
+				continue
+			}
+			go t.handleNewPeerConnection(&offer, fire)
 		}
 	}
-*/
+}
+
 func (t *turnWait) SetCertificatefromX509(cert webrtc.Certificate) {
 	// Lock to ensure thread-safe modification of certificates slice
 	t.mu.Lock()
@@ -253,106 +427,294 @@ func (t *turnWait) SetCertificatefromX509(cert webrtc.Certificate) {
 	defer t.mu.Unlock()
 }
 
-/*
-	func (t *turnWait) handleIncomingCandidates() {
-		candidates := t.fireconn.Candidates()
-		for {
-			select {
-			case <-t.closec:
-				return
-			case cand := <-candidates:
-				t.mu.Lock()
-				conn, ok := t.inProgress[cand.ID]
-				if !ok {
-					t.log.Warn("Received candidate for unknown connection", "id", cand.ID)
+func (t *turnWait) handleIncomingCandidates(fire *waitFire) {
+	candidates := fire.fireconn.Candidates()
+	for {
+		select {
+		case <-t.closec:
+			return
+		case <-fire.closec:
+			return
+		case cand := <-candidates:
+			t.mu.Lock()
+			conn, ok := t.inProgress[cand.ID]
+			if !ok {
+				// The offer may still be on its way, hold on to the candidate.
+				_, known := t.pending[cand.ID]
+				if !known && len(t.pending) >= maxPendingOffers {
 					t.mu.Unlock()
 					continue
 				}
-				t.log.Debug("Received remote ice candidate", "candidate", cand)
-				err := conn.AddICECandidate(cand.Cand)
-				if err != nil {
-					t.log.Error("Error adding ice candidate", "error", err)
+				if len(t.pending[cand.ID]) < maxPendingCandidates {
+					t.pending[cand.ID] = append(t.pending[cand.ID], cand.Cand)
 				}
 				t.mu.Unlock()
+				continue
+			}
+			t.log.Debug("Received remote ice candidate", "candidate", cand.Cand.Candidate)
+			err := t.addCandidate(cand.ID, conn, cand.Cand)
+			t.mu.Unlock()
+			if err != nil {
+				t.reject(cand.ID, conn, err)
 			}
 		}
 	}
-*/
-/*
-func (t *turnWait) handleNewPeerConnection(offer *CampfireOffer) {
+}
+
+// forget removes the offer from the in-progress connections and releases its
+// handshake.
+func (t *turnWait) forget(id string) {
 	t.mu.Lock()
-	t.log.Debug("Creating new peer connection", "offer", offer)
+	defer t.mu.Unlock()
+	delete(t.inProgress, id)
+	delete(t.pending, id)
+	delete(t.handshakes, id)
+	t.checkDrained()
+}
+
+// handedOff marks an added peer as handed to Accept, or dropped with the
+// campfire.
+func (t *turnWait) handedOff() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handoffs--
+	t.checkDrained()
+}
 
-	iceList, err := t.camp.GetICEServers()
+// checkDrained closes drained once a draining campfire has no handshakes
+// left. t.mu must be held.
+func (t *turnWait) checkDrained() {
+	if t.drained != nil && len(t.handshakes) == 0 && t.handoffs == 0 {
+		close(t.drained)
+		t.drained = nil
+	}
+}
+
+// drain stops taking offers and closes the campfire once the handshakes in
+// progress are done and their peers accepted, or once the grace period has
+// passed.
+func (t *turnWait) drain() {
+	t.mu.Lock()
+	t.draining = true
+	drained := make(chan struct{})
+	t.drained = drained
+	t.checkDrained()
+	t.mu.Unlock()
+	go func() {
+		timer := t.opts.clock.NewTimer(t.opts.gracePeriod)
+		defer timer.Stop()
+		select {
+		case <-drained:
+		case <-timer.C():
+			t.log.Debug("Closing campfire with handshakes in progress")
+		case <-t.closec:
+		}
+		t.Close()
+	}()
+}
+
+// authenticateCode checks that the joining peer of the offer knows the code
+// of the campfire. It gives up when the campfire is closed.
+func (t *turnWait) authenticateCode(rw io.ReadWriter, code string, offer *CampfireOffer, pc *webrtc.PeerConnection) error {
+	joinFingerprint, err := remoteFingerprint(offer.SDP)
 	if err != nil {
-		t.log.Warn("failed to generate ice list", "err", err)
+		return err
 	}
-	pc, err := t.api.NewPeerConnection(webrtc.Configuration{
-		ICEServers:   iceList,
-		Certificates: t.certificates,
-	})
+	waitFingerprint, err := remoteFingerprint(*pc.LocalDescription())
 	if err != nil {
-		t.mu.Unlock()
-		t.errc <- fmt.Errorf("new peer connection: %w", err)
+		return err
+	}
+	return authenticateCode(t.ctx, rw, code, offer.ID, joinFingerprint, waitFingerprint, false)
+}
+
+func (t *turnWait) handleNewPeerConnection(offer *CampfireOffer, fire *waitFire) {
+	t.log.Debug("Creating new peer connection", "id", offer.ID)
+	config, err := t.opts.policy.configuration(t.camp)
+	if err != nil {
+		t.forget(offer.ID)
+		t.sendErr(fmt.Errorf("new peer connection: %w", err))
 		return
 	}
-	t.inProgress[offer.ID] = pc
+	t.mu.Lock()
+	config.Certificates = t.certificates
 	t.mu.Unlock()
+	pc, err := fire.api.NewPeerConnection(config)
+	if err != nil {
+		t.forget(offer.ID)
+		t.sendErr(fmt.Errorf("new peer connection: %w", err))
+		return
+	}
+	// settled is closed once the peer is accepted or has failed, which
+	// happens only once.
+	settled := make(chan struct{})
+	var isSettled bool
+	var acceptMu sync.Mutex
+	settle := func() bool {
+		acceptMu.Lock()
+		defer acceptMu.Unlock()
+		if isSettled {
+			return false
+		}
+		isSettled = true
+		close(settled)
+		return true
+	}
+	fail := func(err error) {
+		if !settle() {
+			return
+		}
+		t.forget(offer.ID)
+		pc.Close()
+		t.sendErr(err)
+	}
+	var timeoutOnce sync.Once
 	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
 		if c == nil {
 			return
 		}
 		t.log.Debug("Sending local ice candidate", "candidate", c)
-		err := t.fireconn.SendCandidate(offer.ID, t.location.RemoteUfrag(), t.location.RemotePwd(), c)
+		err := fire.fireconn.SendCandidate(context.Background(), CampfireCandidate{
+			ID:    offer.ID,
+			Ufrag: fire.location.LocalUfrag(),
+			Pwd:   fire.location.LocalPwd(),
+			Cand:  c.ToJSON(),
+		})
 		if err != nil {
 			t.log.Warn("failed to send ice candidate", "err", err)
 		}
 	})
-	pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
-		t.log.Debug("ICE connection state changed", "state", state)
-		if state == webrtc.ICEConnectionStateConnected || state == webrtc.ICEConnectionStateCompleted {
-			t.mu.Lock()
-			delete(t.inProgress, offer.ID)
-			t.mu.Unlock()
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		t.log.Debug("Peer connection state changed", "id", offer.ID, "state", state)
+		switch state {
+		case webrtc.PeerConnectionStateConnected:
+			// The handshake is held until the peer opens its data channel,
+			// which it has to do in time.
+			timeoutOnce.Do(func() {
+				timer := t.opts.clock.NewTimer(handshakeTimeout)
+				go func() {
+					defer timer.Stop()
+					select {
+					case <-timer.C():
+						fail(fmt.Errorf("peer connection %s: %w", offer.ID, ErrHandshakeTimeout))
+					case <-settled:
+					case <-t.closec:
+					}
+				}()
+			})
+		case webrtc.PeerConnectionStateFailed:
+			fail(fmt.Errorf("peer connection %s: %s", offer.ID, state))
 		}
 	})
+	streams := make(chan *Conn, streamBacklog)
+	var opened bool
 	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
 		t.log.Debug("Received data channel", "label", dc.Label())
-		if dc.Label() != string(t.location.PSK) {
-			t.log.Warn("received data channel with unexpected label", "label", dc.Label())
+		acceptMu.Lock()
+		stream := opened
+		opened = true
+		acceptMu.Unlock()
+		if stream {
+			// Data channels after the first are streams of a Session.
+			queueStream(dc, pc, streams, t.log)
+			return
+		}
+		if dc.Label() != fire.location.DataChannelLabel() {
+			// Only a peer that found the same location knows the label.
+			fail(fmt.Errorf("peer connection %s: unexpected data channel label %q", offer.ID, dc.Label()))
 			return
 		}
 		dc.OnOpen(func() {
 			rw, err := dc.Detach()
 			if err != nil {
-				t.errc <- fmt.Errorf("detach data channel: %w", err)
+				fail(fmt.Errorf("detach data channel: %w", err))
+				return
+			}
+			if code, ok := t.camp.Code(); ok {
+				if err := t.authenticateCode(rw, code, offer, pc); err != nil {
+					rw.Close()
+					fail(fmt.Errorf("peer connection %s: %w", offer.ID, err))
+					if errors.Is(err, ErrCodeMismatch) {
+						// Every attempt is a guess at the code, so only one
+						// is allowed.
+						go t.Close()
+					}
+					return
+				}
+			}
+			if !settle() {
+				// The handshake timed out or the connection failed.
+				rw.Close()
+				return
+			}
+			peer := newPeer(newConn(rw, dc, pc, streams), offer.ID, t.opts.clock.Now())
+			if t.authorizer != nil {
+				if err := t.authorizer(t.ctx, peer.PeerInfo); err != nil {
+					t.log.Debug("Peer rejected", "id", offer.ID, "err", err)
+					t.forget(offer.ID)
+					peer.Close()
+					t.sendEvent(Event{Type: EventPeerRejected, Peer: peer.PeerInfo, Err: err})
+					return
+				}
+			}
+			if err := t.addPeer(peer); err != nil {
+				peer.Close()
+				t.reject(offer.ID, nil, err)
 				return
 			}
-			t.acceptc <- rw
+			select {
+			case t.acceptc <- peer:
+			case <-t.closec:
+				peer.Close()
+			}
+			t.handedOff()
 		})
 	})
 	t.log.Debug("remote SDP:", "sdp", offer.SDP.SDP)
 	err = pc.SetRemoteDescription(offer.SDP)
 	if err != nil {
-		t.errc <- fmt.Errorf("set remote description: %w", err)
+		fail(fmt.Errorf("set remote description: %w", err))
+		return
+	}
+	t.mu.Lock()
+	select {
+	case <-t.closec:
+		t.mu.Unlock()
+		pc.Close()
+		return
+	default:
+	}
+	t.inProgress[offer.ID] = pc
+	for _, cand := range t.pending[offer.ID] {
+		if err = t.addCandidate(offer.ID, pc, cand); err != nil {
+			break
+		}
+	}
+	delete(t.pending, offer.ID)
+	t.mu.Unlock()
+	if err != nil {
+		t.reject(offer.ID, pc, err)
 		return
 	}
 	answer, err := pc.CreateAnswer(nil)
 	if err != nil {
-		t.errc <- fmt.Errorf("create answer: %w", err)
+		fail(fmt.Errorf("create answer: %w", err))
 		return
 	}
 	t.log.Debug("local SDP:", "sdp", answer.SDP)
 	err = pc.SetLocalDescription(answer)
 	if err != nil {
-		t.errc <- fmt.Errorf("set local description: %w", err)
+		fail(fmt.Errorf("set local description: %w", err))
 		return
 	}
-	t.log.Debug("Sending answer", "answer", answer)
-	err = t.fireconn.SendAnswer(offer.ID, t.location.RemoteUfrag(), t.location.RemotePwd(), answer)
+	t.log.Debug("Sending answer", "id", offer.ID)
+	err = fire.fireconn.SendAnswer(context.Background(), CampfireAnswer{
+		ID:    offer.ID,
+		Ufrag: fire.location.LocalUfrag(),
+		Pwd:   fire.location.LocalPwd(),
+		SDP:   answer,
+	})
 	if err != nil {
-		t.errc <- fmt.Errorf("send answer: %w", err)
+		fail(fmt.Errorf("send answer: %w", err))
 		return
 	}
 }
-*/
@@ -0,0 +1,276 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWait(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, httpServer := setupSignaling(t)
+	cert, fingerprint := newTestCertificate(t)
+	camp, err := ParseCampfireURI("camp://" + fingerprint + "/?ttl=10m&v=1&0=turn:127.0.0.1:1&1=" + httpServer + "#" + string(MustGeneratePSK()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := camp.Wait(ctx, WithCertificate(cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiresIn := time.Until(cf.(*turnWait).expiresAt); expiresIn > 10*time.Minute+DefaultGracePeriod {
+		t.Fatalf("expected the campfire to expire within its 10m epoch, expires in %s", expiresIn)
+	}
+	if !cf.Opened() {
+		t.Fatal("expected campfire to be opened")
+	}
+
+	waitErrs := make(chan error, 1)
+	go func() {
+		defer close(waitErrs)
+		conn, err := cf.Accept()
+		if err != nil {
+			waitErrs <- err
+			return
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("hello")); err != nil {
+			waitErrs <- err
+		}
+		b := make([]byte, 5)
+		if _, err := conn.Read(b); err != nil {
+			waitErrs <- err
+		}
+	}()
+
+	conn, err := Join(ctx, camp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	b := make([]byte, 5)
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[:n]) != "hello" {
+		t.Fatalf("expected 'hello' got %s", string(b[:n]))
+	}
+	if _, err := conn.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	for err := range waitErrs {
+		t.Fatal(err)
+	}
+
+	if err := cf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if cf.Opened() {
+		t.Fatal("expected campfire to be closed")
+	}
+	if _, err := cf.Accept(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected %v, got %v", ErrClosed, err)
+	}
+	select {
+	case <-cf.Expired():
+	case <-time.After(time.Second):
+		t.Fatal("expected closed campfire to report expiry")
+	}
+}
+
+func TestWaitFingerprintMismatch(t *testing.T) {
+	t.Parallel()
+	_, fingerprint := newTestCertificate(t)
+	other, _ := newTestCertificate(t)
+	camp, err := ParseCampfireURI("camp://" + fingerprint + "/?0=turn:127.0.0.1:1#" + string(MustGeneratePSK()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := camp.Wait(context.Background(), WithCertificate(other)); !errors.Is(err, ErrFingerprintMismatch) {
+		t.Fatalf("expected fingerprint mismatch, got %v", err)
+	}
+	// A random certificate never matches the pinned fingerprint.
+	if _, err := camp.Wait(context.Background()); err == nil || !strings.Contains(err.Error(), "WithCertificate") {
+		t.Fatalf("expected a missing certificate, got %v", err)
+	}
+}
+
+func TestWaitGracePeriod(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, httpServer := setupSignaling(t)
+	cert, fingerprint := newTestCertificate(t)
+	// Meet with a passphrase rather than a PSK.
+	camp, err := ParseCampfireURI("camp://" + fingerprint + "/?kdf=argon2id,t=1,m=1024,p=1&0=turn:127.0.0.1:1&1=" + httpServer + "#correct-horse-battery-staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cf, err := camp.Wait(ctx, WithCertificate(cert), WithGracePeriod(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(cf.(*turnWait).fires); n != 1 {
+		t.Fatalf("expected to listen at 1 epoch without a grace period, got %d", n)
+	}
+	cf.Close()
+
+	// A grace period of a whole epoch always reaches both adjacent epochs.
+	cf, err = camp.Wait(ctx, WithCertificate(cert), WithGracePeriod(DefaultEpoch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Close()
+	if n := len(cf.(*turnWait).fires); n != 3 {
+		t.Fatalf("expected to listen at 3 epochs, got %d", n)
+	}
+	go func() {
+		for {
+			conn, err := cf.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("hello"))
+		}
+	}()
+	psk, err := camp.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidates, err := FindCandidates(psk, camp.TURNServers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, location := range []*Location{candidates[0], candidates[2]} {
+		conn, err := joinAt(ctx, camp, location, newOptions(nil))
+		if err != nil {
+			t.Fatalf("join at %s: %v", location.StartsAt, err)
+		}
+		b := make([]byte, 5)
+		n, err := conn.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b[:n]) != "hello" {
+			t.Fatalf("expected 'hello' got %s", string(b[:n]))
+		}
+		go conn.Close()
+	}
+}
+
+func TestWaitPeers(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	camp, cert := newTestCamp(t, "")
+	cf, err := camp.Wait(ctx, WithCertificate(cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Close()
+
+	joined := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		peer, _ := joinTestCampfire(ctx, t, camp, cf)
+		if joined[peer.ID] {
+			t.Fatalf("expected peers to have distinct IDs, got %s twice", peer.ID)
+		}
+		joined[peer.ID] = true
+		if len(peer.Fingerprint) != 64 || peer.CandidatePair == nil || peer.ConnectedAt.IsZero() {
+			t.Fatalf("expected the peer to be described, got %+v", peer.PeerInfo)
+		}
+	}
+	peers := cf.Peers()
+	if len(peers) != 2 || !peers[0].ConnectedAt.Before(peers[1].ConnectedAt) {
+		t.Fatalf("expected 2 peers in the order they connected, got %d", len(peers))
+	}
+	for _, peer := range peers {
+		if !joined[peer.ID] {
+			t.Fatalf("unexpected peer %s", peer.ID)
+		}
+	}
+
+	// Closed peers are no longer listed.
+	go peers[0].Close()
+	for len(cf.Peers()) != 1 {
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if cf.Peers()[0].ID != peers[1].ID {
+		t.Fatal("expected the other peer to stay listed")
+	}
+}
+
+func TestWaitAuthorizer(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	camp, cert := newTestCamp(t, "")
+	// Reject the first peer only.
+	errRejected := errors.New("not on the guest list")
+	var authorized int
+	cf, err := camp.Wait(ctx, WithCertificate(cert), WithAuthorizer(func(ctx context.Context, peer PeerInfo) error {
+		authorized++
+		if peer.Fingerprint == "" || peer.CandidatePair == nil {
+			t.Errorf("expected the peer to be described, got %+v", peer)
+		}
+		if authorized == 1 {
+			return errRejected
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Close()
+
+	rejected, err := Join(ctx, camp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rejected.Close()
+	event := <-cf.Events()
+	if event.Type != EventPeerRejected || !errors.Is(event.Err, errRejected) {
+		t.Fatalf("expected the peer to be rejected, got %s: %v", event.Type, event.Err)
+	}
+	if _, _, err := rejected.ReadMessage(); err == nil {
+		t.Fatal("expected the rejected peer to be disconnected")
+	}
+
+	peer, _ := joinTestCampfire(ctx, t, camp, cf)
+	if event := <-cf.Events(); event.Type != EventPeerConnected || event.Peer.ID != peer.ID {
+		t.Fatalf("expected the peer to connect, got %s", event.Type)
+	}
+	go peer.Close()
+	if event := <-cf.Events(); event.Type != EventPeerDisconnected || event.Peer.ID != peer.ID {
+		t.Fatalf("expected the peer to disconnect, got %s", event.Type)
+	}
+	select {
+	case err := <-cf.Errors():
+		t.Fatalf("expected no errors, got %v", err)
+	default:
+	}
+}
@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import "time"
+
+// Clock tells the time campfires are found and expire by. It can be replaced
+// with WithClock to simulate epochs passing.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After waits for d to pass and then sends the time on the returned
+	// channel.
+	After(d time.Duration) <-chan time.Time
+	// NewTimer returns a timer that sends the time on its channel after d.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer of a Clock, like time.Timer.
+type Timer interface {
+	// C returns the channel the time is sent on when the timer fires.
+	C() <-chan time.Time
+	// Stop stops the timer and returns false if it already fired or was
+	// stopped.
+	Stop() bool
+	// Reset makes the timer fire after d and returns false if it already
+	// fired or was stopped.
+	Reset(d time.Duration) bool
+}
+
+// SystemClock is the Clock of the time package.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) NewTimer(d time.Duration) Timer         { return systemTimer{time.NewTimer(d)} }
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time { return t.Timer.C }
@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when advanced.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the clock forward by d and fires the timers that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if !t.fire() {
+			timers = append(timers, t)
+		}
+	}
+	c.timers = timers
+}
+
+// Timers returns the number of timers waiting to fire.
+func (c *fakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+type fakeTimer struct {
+	clock  *fakeClock
+	c      chan time.Time
+	at     time.Time
+	active bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.active
+	t.remove()
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.active
+	t.remove()
+	t.at = t.clock.now.Add(d)
+	t.active = true
+	if !t.fire() {
+		t.clock.timers = append(t.clock.timers, t)
+	}
+	return active
+}
+
+// fire sends the time if the timer is due. The clock must be locked.
+func (t *fakeTimer) fire() bool {
+	if t.clock.now.Before(t.at) {
+		return false
+	}
+	t.active = false
+	select {
+	case t.c <- t.clock.now:
+	default:
+	}
+	return true
+}
+
+// remove stops the timer. The clock must be locked.
+func (t *fakeTimer) remove() {
+	t.active = false
+	for i, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			break
+		}
+	}
+}
+
+func TestLocationExpiredClock(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start.Add(30 * time.Minute))
+	location, err := Find(MustGeneratePSK(), []string{"turn:turn.example.com:3478"}, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !location.StartsAt.Equal(start) {
+		t.Fatalf("expected the epoch to start at %s, got %s", start, location.StartsAt)
+	}
+	expired := location.Expired()
+	waitTimers(t, clock, 1)
+	clock.Advance(29 * time.Minute)
+	select {
+	case <-expired:
+		t.Fatal("expected the location not to expire before the end of the epoch")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Advance(time.Minute)
+	select {
+	case <-expired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the location to expire at the end of the epoch")
+	}
+}
+
+func TestWaitClock(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	camp, cert := newTestCamp(t, "")
+	start := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start.Add(10 * time.Minute))
+	cf, err := camp.Wait(ctx, WithCertificate(cert), WithClock(clock), WithGracePeriod(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Close()
+	tw := cf.(*turnWait)
+	fires := func() int {
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		return len(tw.fires)
+	}
+	if n := fires(); n != 1 {
+		t.Fatalf("expected to listen at 1 epoch in the middle of it, got %d", n)
+	}
+	expired := cf.Expired()
+	// The next epoch opens, the current one closes, and then the campfire
+	// expires.
+	waitTimers(t, clock, 3)
+	clock.Advance(49 * time.Minute)
+	waitFor(t, func() bool { return fires() == 2 }, "expected to listen at the next epoch within the grace period")
+	clock.Advance(2 * time.Minute)
+	waitFor(t, func() bool { return fires() == 1 }, "expected to stop listening at the current epoch after the grace period")
+	select {
+	case <-expired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the campfire to expire after the grace period")
+	}
+}
+
+// waitTimers waits until n timers wait on the clock.
+func waitTimers(t *testing.T, clock *fakeClock, n int) {
+	t.Helper()
+	waitFor(t, func() bool { return clock.Timers() >= n }, "expected timers to wait on the clock")
+}
+
+// waitFor polls cond until it holds.
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
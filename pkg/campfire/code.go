@@ -0,0 +1,197 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxNameplate is the largest nameplate of a generated code.
+	maxNameplate = 99
+	// codeWordCount is the number of words of a generated code.
+	codeWordCount = 2
+	// codeTimeout is how long peers have to prove they know the code once
+	// their data channel is open.
+	codeTimeout = 10 * time.Second
+	// pakeCPace is the value of the "pake" argument of code campfires.
+	pakeCPace = "cpace"
+)
+
+// ErrCodeMismatch is returned when the other peer does not know the code.
+var ErrCodeMismatch = errors.New("campfire code mismatch")
+
+// GenerateCode generates a short code such as "7-cedar-harbor" that
+// can be read out to the other peer. The number is the nameplate the peers
+// meet at, the words are the password they prove to each other.
+func GenerateCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(maxNameplate))
+	if err != nil {
+		return "", err
+	}
+	words := make([]byte, codeWordCount)
+	if _, err := rand.Read(words); err != nil {
+		return "", err
+	}
+	code := strconv.FormatInt(n.Int64()+1, 10)
+	for _, w := range words {
+		code += "-" + codeWords[w]
+	}
+	return code, nil
+}
+
+// parseCode returns the nameplate of the code.
+func parseCode(code string) (string, error) {
+	nameplate, words, ok := strings.Cut(code, "-")
+	if !ok || words == "" {
+		return "", fmt.Errorf("invalid code %q, expected a number followed by words", code)
+	}
+	if _, err := strconv.ParseUint(nameplate, 10, 32); err != nil {
+		return "", fmt.Errorf("invalid code %q, expected a number followed by words", code)
+	}
+	return nameplate, nil
+}
+
+// NewCodeCampfire returns the campfire of a code made by GenerateCode, which
+// is met through the given servers. Anyone can find the campfire of a
+// nameplate, so peers prove to each other that they know the whole code with
+// a CPace exchange before the connection is handed out. A wrong code puts out
+// the campfire of the waiting peer, so each code can only be guessed once.
+func NewCodeCampfire(code string, servers []string) (*CampfireURI, error) {
+	if _, err := parseCode(code); err != nil {
+		return nil, err
+	}
+	query := url.Values{"pake": {pakeCPace}}
+	for i, server := range servers {
+		query.Set(strconv.Itoa(i), server)
+	}
+	u := url.URL{
+		Scheme:   "camp",
+		Host:     AnyFingerprint,
+		Path:     "/",
+		RawQuery: serverEscaper.Replace(query.Encode()),
+		Fragment: code,
+	}
+	return ParseCampfireURI(u.String())
+}
+
+// Code returns the code of the campfire, if it is met with a code.
+func (camp *CampfireURI) Code() (string, bool) {
+	args, err := url.ParseQuery(camp.Arguments)
+	if err != nil || args.Get("pake") == "" {
+		return "", false
+	}
+	return camp.PSK, true
+}
+
+// nameplateKey returns the PSK of the campfire of a nameplate. It is not a
+// secret, the code is.
+func nameplateKey(nameplate string) []byte {
+	sum := sha256.Sum256([]byte("campfire nameplate " + nameplate))
+	return sum[:]
+}
+
+// authenticateCode proves to the other peer that this peer knows the code,
+// and checks that it does too. The DTLS fingerprints of both peers are bound
+// into the exchange, so a peer in the middle of the connection cannot relay
+// it. rw is closed if ctx is done before the exchange completes.
+func authenticateCode(ctx context.Context, rw io.ReadWriter, code, sid, joinFingerprint, waitFingerprint string, joining bool) (err error) {
+	deadline := time.Now().Add(codeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if d, ok := rw.(interface{ SetReadDeadline(time.Time) error }); ok {
+		_ = d.SetReadDeadline(deadline)
+		defer d.SetReadDeadline(time.Time{})
+	}
+	if c, ok := rw.(io.Closer); ok {
+		stop := context.AfterFunc(ctx, func() { c.Close() })
+		defer stop()
+	}
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}()
+	ci := append(prependLen([]byte(joinFingerprint)), prependLen([]byte(waitFingerprint))...)
+	c, err := newCPace([]byte(code), []byte(sid), ci, joining)
+	if err != nil {
+		return err
+	}
+	if _, err := rw.Write(c.Share()); err != nil {
+		return fmt.Errorf("send cpace share: %w", err)
+	}
+	peerShare, err := readMessage(rw, len(c.Share()))
+	if err != nil {
+		return fmt.Errorf("read cpace share: %w", err)
+	}
+	isk, err := c.Finish(peerShare)
+	if err != nil {
+		return err
+	}
+	if joining {
+		// The joining peer confirms first and hangs up on a wrong code.
+		if _, err := rw.Write(confirmCode(isk, "join")); err != nil {
+			return fmt.Errorf("send code confirmation: %w", err)
+		}
+		confirmation, err := readMessage(rw, sha256.Size)
+		if err != nil {
+			return fmt.Errorf("read code confirmation: %w", err)
+		}
+		if !hmac.Equal(confirmation, confirmCode(isk, "wait")) {
+			return ErrCodeMismatch
+		}
+		return nil
+	}
+	confirmation, err := readMessage(rw, sha256.Size)
+	if err != nil {
+		return fmt.Errorf("read code confirmation: %w", err)
+	}
+	// Confirm even to a peer with the wrong code, so it learns why it fails.
+	if _, err := rw.Write(confirmCode(isk, "wait")); err != nil {
+		return fmt.Errorf("send code confirmation: %w", err)
+	}
+	if !hmac.Equal(confirmation, confirmCode(isk, "join")) {
+		// Closing now could drop the confirmation, so wait for the joining
+		// peer to hang up.
+		_, _ = rw.Read(make([]byte, 1))
+		return ErrCodeMismatch
+	}
+	return nil
+}
+
+// confirmCode returns the key confirmation of the role.
+func confirmCode(isk []byte, role string) []byte {
+	mac := hmac.New(sha256.New, isk)
+	mac.Write([]byte("campfire code confirmation " + role))
+	return mac.Sum(nil)
+}
+
+// readMessage reads a message of exactly size bytes.
+func readMessage(r io.Reader, size int) ([]byte, error) {
+	buf := make([]byte, size+1)
+	n, err := r.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	if n != size {
+		return nil, fmt.Errorf("expected a message of %d bytes, got %d", size, n)
+	}
+	return buf[:n], nil
+}
@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestGenerateCode(t *testing.T) {
+	seen := make(map[string]bool, len(codeWords))
+	for _, word := range codeWords {
+		if word == "" || seen[word] {
+			t.Fatalf("code word %q is empty or repeated", word)
+		}
+		seen[word] = true
+	}
+	format := regexp.MustCompile(`^[1-9][0-9]?-[a-z]+-[a-z]+$`)
+	for i := 0; i < 100; i++ {
+		code, err := GenerateCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !format.MatchString(code) {
+			t.Fatalf("unexpected code %q", code)
+		}
+	}
+}
+
+func TestNewCodeCampfire(t *testing.T) {
+	camp, err := NewCodeCampfire("7-cedar-harbor", []string{"campfire:campfire@127.0.0.1:3478"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, ok := camp.Code(); !ok || code != "7-cedar-harbor" {
+		t.Fatalf("expected the code of the campfire, got %q", code)
+	}
+	if len(camp.TURNServers) != 1 || camp.TURNServers[0] != "campfire:campfire@127.0.0.1:3478" {
+		t.Fatalf("unexpected TURN servers %v", camp.TURNServers)
+	}
+	// The campfire survives a round trip through its URI.
+	camp, err = ParseCampfireURI(camp.EncodeURI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := camp.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Peers meet by the nameplate, the words are never part of the key.
+	other, err := NewCodeCampfire("7-falcon-comet", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := other.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, otherKey) {
+		t.Fatal("expected codes with the same nameplate to meet at the same campfire")
+	}
+	for _, code := range []string{"", "cedar-harbor", "7", "7-", "x-cedar"} {
+		if _, err := NewCodeCampfire(code, nil); err == nil {
+			t.Fatalf("expected code %q to be rejected", code)
+		}
+	}
+	if _, err := ParseCampfireURI("camp://any/?pake=spake2#7-cedar-harbor"); err == nil {
+		t.Fatal("expected an unsupported pake to be rejected")
+	}
+}
+
+func TestAuthenticateCodeContext(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	local, remote := net.Pipe()
+	defer remote.Close()
+	// The other peer reads the share but never answers.
+	go func() { _, _ = io.Copy(io.Discard, remote) }()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- authenticateCode(ctx, local, "7-cedar-harbor", "sid", "join", "wait", true)
+	}()
+	cancel()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(codeTimeout / 2):
+		t.Fatal("expected the exchange to give up when the context is done")
+	}
+}
+
+func TestCodeCampfire(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, httpServer := setupSignaling(t)
+	code, err := GenerateCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	camp, err := NewCodeCampfire(code, []string{"turn:127.0.0.1:1", httpServer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := camp.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Close()
+	go func() {
+		conn, err := cf.Accept()
+		if err != nil {
+			return
+		}
+		_, _ = conn.Write([]byte("hello"))
+	}()
+
+	conn, err := Join(ctx, camp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	b := make([]byte, 5)
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[:n]) != "hello" {
+		t.Fatalf("expected 'hello' got %s", string(b[:n]))
+	}
+}
+
+func TestCodeCampfireMismatch(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, httpServer := setupSignaling(t)
+	servers := []string{"turn:127.0.0.1:1", httpServer}
+	camp, err := NewCodeCampfire("7-cedar-harbor", servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := camp.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Close()
+	go func() {
+		if conn, err := cf.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+
+	guess, err := NewCodeCampfire("7-cedar-comet", servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Join(ctx, guess); !errors.Is(err, ErrCodeMismatch) {
+		t.Fatalf("expected ErrCodeMismatch, got %v", err)
+	}
+	select {
+	case err := <-cf.Errors():
+		if !errors.Is(err, ErrCodeMismatch) {
+			t.Fatalf("expected ErrCodeMismatch, got %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+	// A wrong code puts the campfire out.
+	deadline := time.Now().Add(5 * time.Second)
+	for cf.Opened() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a wrong code to put the campfire out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
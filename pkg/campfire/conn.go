@@ -0,0 +1,286 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pion/datachannel"
+	"github.com/pion/webrtc/v3"
+)
+
+// MaxMessageSize is the largest message a data channel carries. pion does not
+// negotiate the max-message-size of the SDP and holds both peers to 64 KiB.
+const MaxMessageSize = 65536
+
+// ErrMessageTooLarge is returned for messages larger than MaxMessageSize.
+// WriteMessage never splits a message, unlike Write.
+var ErrMessageTooLarge = errors.New("message too large")
+
+// MessageConn is a connection that preserves the boundaries of the messages
+// sent over it. Conn implements it.
+type MessageConn interface {
+	net.Conn
+	// ReadMessage reads the next message and whether it was sent as a
+	// string.
+	ReadMessage() (msg []byte, isString bool, err error)
+	// WriteMessage sends b as a single message, as a string if isString.
+	WriteMessage(b []byte, isString bool) error
+}
+
+var _ MessageConn = (*Conn)(nil)
+
+// Conn is a connection to a peer over a detached data channel. It implements
+// net.Conn. The connection returned by Join or Accept closes its peer
+// connection when closed, the streams of a Session only close their own data
+// channel.
+type Conn struct {
+	rw datachannel.ReadWriteCloser
+	dc *webrtc.DataChannel
+	pc *webrtc.PeerConnection
+	// streams queues the data channels opened by the peer, nil for streams.
+	streams chan *Conn
+	// done is closed once the peer connection is closed.
+	done     chan struct{}
+	doneOnce sync.Once
+
+	mu            sync.Mutex
+	writeDeadline time.Time
+
+	readMu  sync.Mutex
+	readBuf []byte
+	// unread is the rest of the last message, which Read hands out over
+	// several calls.
+	unread         []byte
+	unreadIsString bool
+}
+
+var _ net.Conn = (*Conn)(nil)
+
+// newConn returns the connection of the first data channel of a peer
+// connection. Data channels opened later by the peer are read from streams.
+func newConn(rw datachannel.ReadWriteCloser, dc *webrtc.DataChannel, pc *webrtc.PeerConnection, streams chan *Conn) *Conn {
+	c := &Conn{rw: rw, dc: dc, pc: pc, streams: streams, done: make(chan struct{})}
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			c.doneOnce.Do(func() { close(c.done) })
+		}
+	})
+	return c
+}
+
+// newStream returns the connection of a data channel of a Session.
+func newStream(rw datachannel.ReadWriteCloser, dc *webrtc.DataChannel, pc *webrtc.PeerConnection) *Conn {
+	return &Conn{rw: rw, dc: dc, pc: pc}
+}
+
+// Read reads the messages of the data channel as a byte stream. A message
+// larger than b is handed out over the following reads.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if len(b) == 0 {
+		return 0, nil
+	}
+	for len(c.unread) == 0 {
+		if err := c.readDataChannel(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, c.unread)
+	c.unread = c.unread[n:]
+	return n, nil
+}
+
+// ReadMessage reads the next message from the data channel. The rest of a
+// message partly read with Read is returned first.
+func (c *Conn) ReadMessage() ([]byte, bool, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if len(c.unread) == 0 {
+		if err := c.readDataChannel(); err != nil {
+			return nil, false, err
+		}
+	}
+	msg := bytes.Clone(c.unread)
+	c.unread = nil
+	return msg, c.unreadIsString, nil
+}
+
+// readDataChannel reads the next message into unread. c.readMu must be held.
+func (c *Conn) readDataChannel() error {
+	if c.readBuf == nil {
+		c.readBuf = make([]byte, MaxMessageSize)
+	}
+	n, isString, err := c.rw.ReadDataChannel(c.readBuf)
+	if errors.Is(err, io.ErrShortBuffer) {
+		return fmt.Errorf("%w: received more than %d bytes", ErrMessageTooLarge, MaxMessageSize)
+	}
+	if err != nil {
+		return err
+	}
+	c.unread, c.unreadIsString = c.readBuf[:n], isString
+	return nil
+}
+
+// Write writes b to the data channel as binary messages of at most
+// MaxMessageSize bytes, so writes of any size arrive as a byte stream. Writes
+// do not block, so the write deadline only fails writes once it has passed.
+func (c *Conn) Write(b []byte) (int, error) {
+	n := 0
+	for {
+		chunk := b[n:]
+		if len(chunk) > MaxMessageSize {
+			chunk = chunk[:MaxMessageSize]
+		}
+		if err := c.checkDeadline(); err != nil {
+			return n, err
+		}
+		m, err := c.rw.Write(chunk)
+		n += m
+		if err != nil || n == len(b) {
+			return n, err
+		}
+	}
+}
+
+// WriteMessage writes b to the data channel as a single message, as a string
+// if isString. Messages larger than MaxMessageSize fail with
+// ErrMessageTooLarge.
+func (c *Conn) WriteMessage(b []byte, isString bool) error {
+	if len(b) > MaxMessageSize {
+		return fmt.Errorf("%w: %d bytes is more than %d", ErrMessageTooLarge, len(b), MaxMessageSize)
+	}
+	if err := c.checkDeadline(); err != nil {
+		return err
+	}
+	_, err := c.rw.WriteDataChannel(b, isString)
+	return err
+}
+
+// checkDeadline returns os.ErrDeadlineExceeded once the write deadline has
+// passed.
+func (c *Conn) checkDeadline() error {
+	c.mu.Lock()
+	deadline := c.writeDeadline
+	c.mu.Unlock()
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+
+// Close closes the data channel, and the underlying peer connection unless
+// the connection is a stream of a Session.
+func (c *Conn) Close() error {
+	err := c.rw.Close()
+	if c.done == nil {
+		return err
+	}
+	if pcErr := c.pc.Close(); err == nil {
+		err = pcErr
+	}
+	c.doneOnce.Do(func() { close(c.done) })
+	return err
+}
+
+// LocalAddr returns the address of the local candidate of the selected ICE
+// candidate pair.
+func (c *Conn) LocalAddr() net.Addr {
+	local, _ := c.selectedCandidates()
+	return candidateAddr(local)
+}
+
+// RemoteAddr returns the address of the remote candidate of the selected ICE
+// candidate pair.
+func (c *Conn) RemoteAddr() net.Addr {
+	_, remote := c.selectedCandidates()
+	return candidateAddr(remote)
+}
+
+// SetDeadline sets the read and write deadlines.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return errors.Join(c.SetReadDeadline(t), c.SetWriteDeadline(t))
+}
+
+// SetReadDeadline sets the deadline for reads to return
+// os.ErrDeadlineExceeded.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	d, ok := c.rw.(datachannel.ReadDeadliner)
+	if !ok {
+		return errors.New("data channel does not support read deadlines")
+	}
+	return d.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for writes to return
+// os.ErrDeadlineExceeded.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	return nil
+}
+
+// DataChannel returns the data channel of the connection, for callers that
+// need more than net.Conn offers. Reading or writing through it bypasses the
+// connection.
+func (c *Conn) DataChannel() *webrtc.DataChannel {
+	return c.dc
+}
+
+// PeerConnection returns the peer connection the data channel belongs to.
+func (c *Conn) PeerConnection() *webrtc.PeerConnection {
+	return c.pc
+}
+
+// selectedCandidates returns the selected ICE candidate pair, or nils before
+// one is selected.
+func (c *Conn) selectedCandidates() (local, remote *webrtc.ICECandidate) {
+	sctp := c.pc.SCTP()
+	if sctp == nil || sctp.Transport() == nil || sctp.Transport().ICETransport() == nil {
+		return nil, nil
+	}
+	pair, err := sctp.Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil || pair == nil {
+		return nil, nil
+	}
+	return pair.Local, pair.Remote
+}
+
+// candidateAddr returns the address of an ICE candidate.
+func candidateAddr(c *webrtc.ICECandidate) net.Addr {
+	if c == nil {
+		return &net.UDPAddr{}
+	}
+	ip := net.ParseIP(c.Address)
+	if c.Protocol == webrtc.ICEProtocolTCP {
+		return &net.TCPAddr{IP: ip, Port: int(c.Port)}
+	}
+	if ip == nil {
+		// mDNS candidates have a host name rather than an IP.
+		return &candidateHostAddr{network: "udp", address: net.JoinHostPort(c.Address, strconv.Itoa(int(c.Port)))}
+	}
+	return &net.UDPAddr{IP: ip, Port: int(c.Port)}
+}
+
+// candidateHostAddr is the address of a candidate with a host name.
+type candidateHostAddr struct {
+	network, address string
+}
+
+func (a *candidateHostAddr) Network() string { return a.network }
+func (a *candidateHostAddr) String() string  { return a.address }
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestConn(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, _, peer, joined := connectTestCampfire(ctx, t, "")
+	var conn net.Conn = joined
+
+	// Both ends agree on the selected candidate pair.
+	if conn.LocalAddr().String() != peer.RemoteAddr().String() || conn.RemoteAddr().String() != peer.LocalAddr().String() {
+		t.Fatalf("expected matching addresses, got %s->%s and %s->%s", conn.LocalAddr(), conn.RemoteAddr(), peer.LocalAddr(), peer.RemoteAddr())
+	}
+	if addr, ok := conn.RemoteAddr().(*net.UDPAddr); !ok || addr.Port == 0 {
+		t.Fatalf("expected the UDP address of the selected candidate, got %#v", conn.RemoteAddr())
+	}
+	if peer.DataChannel() == nil || peer.PeerConnection() == nil {
+		t.Fatal("expected the data channel to be reachable")
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Read(make([]byte, 5)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", os.ErrDeadlineExceeded, err)
+	}
+	if err := conn.SetWriteDeadline(time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("hello")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", os.ErrDeadlineExceeded, err)
+	}
+
+	// Clearing the deadlines makes the connection usable again.
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := peer.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 5)
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[:n]) != "hello" {
+		t.Fatalf("expected 'hello' got %s", string(b[:n]))
+	}
+	if _, err := conn.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read hands out a message larger than its buffer over several calls.
+	large := make([]byte, 20000)
+	for i := range large {
+		large[i] = byte(i)
+	}
+	if _, err := peer.Write(large); err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	chunk := make([]byte, 4096)
+	for len(got) < len(large) {
+		n, err := conn.Read(chunk)
+		if err != nil {
+			t.Fatalf("read after %d bytes: %v", len(got), err)
+		}
+		got = append(got, chunk[:n]...)
+	}
+	if !bytes.Equal(got, large) {
+		t.Fatal("expected the message to be read in chunks")
+	}
+
+	// Write splits what it is handed into messages, so it streams any size.
+	large = bytes.Repeat(large, 10)
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(peer, bytes.NewReader(large))
+		copied <- err
+	}()
+	got = make([]byte, len(large))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-copied; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, large) {
+		t.Fatalf("expected to copy %d bytes through the connection", len(large))
+	}
+
+	// Messages keep their boundaries and kind, up to MaxMessageSize.
+	messages := []struct {
+		b        []byte
+		isString bool
+	}{
+		{[]byte("hello"), true},
+		{bytes.Repeat([]byte{1}, MaxMessageSize), false},
+		{[]byte{}, false},
+	}
+	for _, m := range messages {
+		if err := peer.WriteMessage(m.b, m.isString); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := peer.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range messages {
+		b, isString, err := conn.(MessageConn).ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, m.b) || isString != m.isString {
+			t.Fatalf("expected a message of %d bytes (string %t), got %d bytes (string %t)", len(m.b), m.isString, len(b), isString)
+		}
+	}
+	if err := peer.WriteMessage(make([]byte, MaxMessageSize+1), false); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("expected %v, got %v", ErrMessageTooLarge, err)
+	}
+}
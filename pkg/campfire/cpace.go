@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// CPace domain separation identifiers for X25519 (draft-irtf-cfrg-cpace).
+const (
+	cpaceDSI    = "CPace255"
+	cpaceDSIISK = "CPace255_ISK"
+	// cpaceHashBlockSize is the input block size of SHA-512.
+	cpaceHashBlockSize = 128
+)
+
+var (
+	// curve25519P is the field prime 2^255 - 19.
+	curve25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	// curve25519A is the A coefficient of the Montgomery form of Curve25519.
+	curve25519A = big.NewInt(486662)
+)
+
+// cpace is one side of a CPace exchange over X25519. Both sides derive the
+// same generator from the password, the session ID and the channel
+// identifier, exchange a public share and end up with the same intermediate
+// session key only if they used the same password.
+type cpace struct {
+	priv    *ecdh.PrivateKey
+	share   []byte
+	sid     []byte
+	joining bool
+}
+
+// newCPace starts a CPace exchange for the password. The joining peer's share
+// is ordered first in the transcript.
+func newCPace(password, sid, ci []byte, joining bool) (*cpace, error) {
+	generator, err := ecdh.X25519().NewPublicKey(cpaceGenerator(password, sid, ci))
+	if err != nil {
+		return nil, fmt.Errorf("cpace generator: %w", err)
+	}
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("cpace scalar: %w", err)
+	}
+	share, err := priv.ECDH(generator)
+	if err != nil {
+		return nil, fmt.Errorf("cpace share: %w", err)
+	}
+	return &cpace{priv: priv, share: share, sid: sid, joining: joining}, nil
+}
+
+// Share returns the public share to send to the other peer.
+func (c *cpace) Share() []byte { return c.share }
+
+// Finish returns the intermediate session key for the share of the other
+// peer.
+func (c *cpace) Finish(peerShare []byte) ([]byte, error) {
+	peer, err := ecdh.X25519().NewPublicKey(peerShare)
+	if err != nil {
+		return nil, fmt.Errorf("cpace peer share: %w", err)
+	}
+	// ECDH rejects shares of low order, which would force a known key.
+	k, err := c.priv.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("cpace key: %w", err)
+	}
+	joinShare, waitShare := c.share, peerShare
+	if !c.joining {
+		joinShare, waitShare = peerShare, c.share
+	}
+	h := sha512.New()
+	for _, field := range [][]byte{[]byte(cpaceDSIISK), c.sid, k, joinShare, waitShare} {
+		h.Write(prependLen(field))
+	}
+	return h.Sum(nil), nil
+}
+
+// cpaceGenerator maps the password and session to a point of Curve25519.
+func cpaceGenerator(password, sid, ci []byte) []byte {
+	dsi := prependLen([]byte(cpaceDSI))
+	prs := prependLen(password)
+	zpad := cpaceHashBlockSize - len(dsi) - len(prs) - 1
+	if zpad < 0 {
+		zpad = 0
+	}
+	h := sha512.New()
+	h.Write(dsi)
+	h.Write(prs)
+	h.Write(prependLen(make([]byte, zpad)))
+	h.Write(prependLen(ci))
+	h.Write(prependLen(sid))
+	sum := h.Sum(nil)
+	// The first half of the hash, little endian and reduced, is the field
+	// element that is mapped to the curve.
+	le := sum[:32]
+	le[31] &= 0x7f
+	r := new(big.Int).SetBytes(reverse(le))
+	r.Mod(r, curve25519P)
+	return littleEndian(elligator2(r))
+}
+
+// elligator2 maps a field element to the u-coordinate of a point of
+// Curve25519 (RFC 9380, section 6.7.1). It is not constant time, but its
+// input is hashed with the session ID, which differs for every offer.
+func elligator2(r *big.Int) *big.Int {
+	p := curve25519P
+	// x1 = -A / (1 + 2r^2), or -A when the denominator vanishes.
+	d := new(big.Int).Mul(r, r)
+	d.Lsh(d, 1)
+	d.Add(d, big.NewInt(1))
+	d.Mod(d, p)
+	x1 := new(big.Int).Neg(curve25519A)
+	if d.Sign() != 0 {
+		x1.Mul(x1, new(big.Int).ModInverse(d, p))
+	}
+	x1.Mod(x1, p)
+	// gx1 = x1^3 + A*x1^2 + x1
+	gx1 := new(big.Int).Add(x1, curve25519A)
+	gx1.Mul(gx1, x1)
+	gx1.Add(gx1, big.NewInt(1))
+	gx1.Mul(gx1, x1)
+	gx1.Mod(gx1, p)
+	if isSquare(gx1) {
+		return x1
+	}
+	// Otherwise -x1 - A is on the curve.
+	x2 := new(big.Int).Neg(x1)
+	x2.Sub(x2, curve25519A)
+	return x2.Mod(x2, p)
+}
+
+// isSquare returns true if x is a square modulo the field prime.
+func isSquare(x *big.Int) bool {
+	if x.Sign() == 0 {
+		return true
+	}
+	exp := new(big.Int).Rsh(new(big.Int).Sub(curve25519P, big.NewInt(1)), 1)
+	return new(big.Int).Exp(x, exp, curve25519P).Cmp(big.NewInt(1)) == 0
+}
+
+// prependLen prefixes b with its LEB128 encoded length.
+func prependLen(b []byte) []byte {
+	return append(binary.AppendUvarint(nil, uint64(len(b))), b...)
+}
+
+// littleEndian encodes a field element in 32 little endian bytes.
+func littleEndian(x *big.Int) []byte {
+	out := make([]byte, 32)
+	return reverse(x.FillBytes(out))
+}
+
+func reverse(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"math/big"
+	"testing"
+)
+
+func TestCPace(t *testing.T) {
+	exchange := func(joinPassword, waitPassword string) (joinKey, waitKey []byte) {
+		t.Helper()
+		sid, ci := []byte("session"), []byte("channel")
+		join, err := newCPace([]byte(joinPassword), sid, ci, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wait, err := newCPace([]byte(waitPassword), sid, ci, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if joinKey, err = join.Finish(wait.Share()); err != nil {
+			t.Fatal(err)
+		}
+		if waitKey, err = wait.Finish(join.Share()); err != nil {
+			t.Fatal(err)
+		}
+		return joinKey, waitKey
+	}
+	joinKey, waitKey := exchange("7-cedar-harbor", "7-cedar-harbor")
+	if !bytes.Equal(joinKey, waitKey) {
+		t.Fatal("expected peers with the same password to agree on a key")
+	}
+	joinKey, waitKey = exchange("7-cedar-harbor", "7-cedar-comet")
+	if bytes.Equal(joinKey, waitKey) {
+		t.Fatal("expected peers with different passwords to disagree on a key")
+	}
+
+	// A low order share must not force a known key.
+	c, err := newCPace([]byte("7-cedar-harbor"), nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Finish(make([]byte, 32)); err == nil {
+		t.Fatal("expected a low order share to be rejected")
+	}
+}
+
+func TestElligator2(t *testing.T) {
+	for _, r := range []int64{0, 1, 2, 3, 12345} {
+		u := elligator2(big.NewInt(r))
+		// u is on the curve if u^3 + A*u^2 + u is a square.
+		v := new(big.Int).Add(u, curve25519A)
+		v.Mul(v, u)
+		v.Add(v, big.NewInt(1))
+		v.Mul(v, u)
+		if !isSquare(v.Mod(v, curve25519P)) {
+			t.Fatalf("elligator2(%d) is not on the curve", r)
+		}
+		if _, err := ecdh.X25519().NewPublicKey(littleEndian(u)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
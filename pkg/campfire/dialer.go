@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Dialer joins campfires, for libraries that dial with a DialContext
+// function such as http.Transport or grpc.WithContextDialer. The camp URI is
+// parsed again for every connection, so nothing secret outlives the
+// connection it was used for.
+type Dialer struct {
+	// Resolve returns the camp URI of an address that is not a camp URI
+	// itself, such as the "host:port" dialed by http.Transport. Without it
+	// only camp URIs can be dialed.
+	Resolve func(ctx context.Context, addr string) (string, error)
+	// Options are passed to Join for every connection.
+	Options []Option
+}
+
+// DialContext joins the campfire of addr, which is a camp URI or a name
+// resolved to one by Resolve. The network is ignored, so that the dialer
+// can stand in for a TCP one.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	uri := addr
+	if !strings.HasPrefix(strings.ToLower(addr), "camp:") {
+		if d.Resolve == nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: fmt.Errorf("%q is not a camp URI", addr)}
+		}
+		var err error
+		uri, err = d.Resolve(ctx, addr)
+		if err != nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: fmt.Errorf("resolve %q: %w", addr, err)}
+		}
+	}
+	camp, err := ParseCampfireURI(uri)
+	if err != nil {
+		// Parse errors quote the URI, PSK and all.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, &net.OpError{Op: "dial", Net: network, Err: fmt.Errorf("invalid camp URI: %w", err)}
+	}
+	conn, err := Join(ctx, camp, d.Options...)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Addr: Addr{camp: camp}, Err: err}
+	}
+	return conn, nil
+}
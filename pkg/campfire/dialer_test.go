@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDialer(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	camp, cert := newTestCamp(t, "")
+	uri := camp.EncodeURI()
+	l, err := Listen(ctx, camp, WithCertificate(cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	})}
+	go server.Serve(l)
+
+	dialer := &Dialer{Resolve: func(ctx context.Context, addr string) (string, error) {
+		if addr != "campfire:80" {
+			return "", errors.New("unknown campfire")
+		}
+		return uri, nil
+	}}
+	client := &http.Client{Transport: &http.Transport{DialContext: dialer.DialContext}}
+	defer client.CloseIdleConnections()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://campfire/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "hello" {
+		t.Fatalf("expected 'hello' got %s", body)
+	}
+}
+
+func TestDialerErrors(t *testing.T) {
+	ctx := context.Background()
+	if _, err := (&Dialer{}).DialContext(ctx, "tcp", "campfire:80"); err == nil {
+		t.Fatal("expected an error dialing a name without a resolver")
+	}
+	dialer := &Dialer{Resolve: func(context.Context, string) (string, error) {
+		return "", errors.New("unknown campfire")
+	}}
+	if _, err := dialer.DialContext(ctx, "tcp", "campfire:80"); err == nil || !strings.Contains(err.Error(), "unknown campfire") {
+		t.Fatalf("expected the resolver error, got %v", err)
+	}
+	_, err := (&Dialer{}).DialContext(ctx, "tcp", "camp://any/?0=%zz#secret-passphrase")
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("expected a *net.OpError, got %v", err)
+	}
+	if strings.Contains(err.Error(), "secret-passphrase") {
+		t.Fatalf("expected the error to hide the PSK, got %v", err)
+	}
+	// The options of the dialer are passed to Join.
+	dialer = &Dialer{Options: []Option{WithPolicy(PolicyRelay)}}
+	if _, err := dialer.DialContext(ctx, "tcp", "camp://any/?0=stun:127.0.0.1:1#secret-passphrase"); !errors.Is(err, ErrPolicyUnsatisfiable) {
+		t.Fatalf("expected %v, got %v", ErrPolicyUnsatisfiable, err)
+	}
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"time"
+)
+
+// maxPendingEvents is the number of events held for a slow reader before
+// new ones are dropped.
+const maxPendingEvents = 64
+
+// Authorizer decides whether a peer that completed the DTLS handshake may be
+// accepted. Returning an error rejects the peer.
+type Authorizer func(ctx context.Context, peer PeerInfo) error
+
+// EventType is the kind of an Event.
+type EventType int
+
+const (
+	// EventPeerConnected is sent when a peer is queued for Accept.
+	EventPeerConnected EventType = iota
+	// EventPeerRejected is sent when the Authorizer rejects a peer, or when
+	// a peer is turned away by the limits of the campfire with
+	// ErrTooManyHandshakes or ErrTooManyPeers.
+	EventPeerRejected
+	// EventPeerDisconnected is sent when the connection to an accepted peer
+	// closes.
+	EventPeerDisconnected
+)
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventPeerConnected:
+		return "peer connected"
+	case EventPeerRejected:
+		return "peer rejected"
+	case EventPeerDisconnected:
+		return "peer disconnected"
+	default:
+		return "unknown event"
+	}
+}
+
+// Event reports something that happened to a peer of a campfire.
+type Event struct {
+	Type EventType
+	Peer PeerInfo
+	// Err is why the peer was rejected: the error of the Authorizer,
+	// ErrTooManyHandshakes or ErrTooManyPeers.
+	Err  error
+	Time time.Time
+}
@@ -10,6 +10,7 @@ package campfire
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"strconv"
@@ -19,9 +20,6 @@ import (
 // PSKSize is the size of the PSK in bytes.
 const PSKSize = 32
 
-// Now is the current time. It is a variable so it can be mocked out in tests.
-var Now = time.Now
-
 // Location is the secret and location of a campfire.
 type Location struct {
 	// PSK is the pre-shared key.
@@ -32,44 +30,119 @@ type Location struct {
 	RemoteSecret string
 	// TURNServer is the selected TURN server.
 	TURNServer string
+	// StartsAt is the start of the epoch of the campfire.
+	StartsAt time.Time
 	// ExpiresAt is the time at which the campfire expires.
 	ExpiresAt time.Time
+	// Protocol is the protocol version the location was derived with.
+	Protocol string
+	// Waiting is true when the location is used by the waiting peer. The
+	// credentials of the joining peer are its local credentials, so the
+	// waiting peer sees them the other way around.
+	Waiting bool
+	// Clock tells the time Expired waits for. SystemClock is used if nil.
+	Clock Clock
+}
+
+// DefaultEpoch is the lifetime of a campfire location unless the camp URI
+// sets another one. Secrets are derived from the start of the epoch, so peers
+// meet as long as their clocks agree on it.
+const DefaultEpoch = time.Hour
+
+// MinEpoch is the shortest epoch a campfire can use.
+const MinEpoch = time.Minute
+
+// epochStart returns the start of the epoch t falls in.
+func epochStart(t time.Time, epoch time.Duration) time.Time {
+	return t.UTC().Truncate(epoch)
+}
+
+// formatEpoch formats the start of an epoch for key derivation. The default
+// epoch keeps the given layout so hourly campfires stay compatible, while
+// other epochs are formatted to the second and bound to their length.
+func formatEpoch(start time.Time, epoch time.Duration, layout string) string {
+	if epoch == DefaultEpoch {
+		return start.Format(layout)
+	}
+	return start.Format("2006-01-02 15:04:05") + " " + epoch.String()
 }
 
 // Find finds a campfire using the given PSK and TURN servers.
 // If turnServers is empty, a default list will be fetched from
 // always-online-stun.
-func Find(psk []byte, turnServers []string) (*Location, error) {
+func Find(psk []byte, turnServers []string, opts ...Option) (*Location, error) {
+	o := newOptions(opts)
+	return findAt(psk, turnServers, o.clock.Now(), o)
+}
+
+// FindCandidates returns the locations of the campfire in the previous,
+// current and next epoch, so peers whose clocks straddle an epoch boundary
+// can still meet.
+func FindCandidates(psk []byte, turnServers []string, opts ...Option) ([]*Location, error) {
+	o := newOptions(opts)
+	current := epochStart(o.clock.Now(), o.epoch)
+	var locations []*Location
+	for _, start := range []time.Time{current.Add(-o.epoch), current, current.Add(o.epoch)} {
+		location, err := findAt(psk, turnServers, start, o)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, location)
+	}
+	return locations, nil
+}
+
+// findAt finds the campfire of the epoch t falls in.
+func findAt(psk []byte, turnServers []string, t time.Time, o *options) (*Location, error) {
 	if len(psk) == 0 {
 		return nil, fmt.Errorf("PSK must not be empty")
 	} else if len(psk) != PSKSize {
-		return nil, fmt.Errorf("PSK must be %d bytes", PSKSize)
+		return nil, fmt.Errorf("PSK must be %d bytes, stretch passphrases with StretchPSK", PSKSize)
 	}
 	if len(turnServers) == 0 {
 		return nil, fmt.Errorf("turnServers must not be empty")
 	}
-	t := Now().Truncate(time.Hour)
-	localsecret, err := computeSecret(t.UTC(), psk, true)
-	if err != nil {
-		return nil, fmt.Errorf("compute local secret: %w", err)
+	if o.epoch < MinEpoch {
+		return nil, fmt.Errorf("epoch must be at least %s", MinEpoch)
 	}
-	remotesecret, err := computeSecret(t.UTC(), psk, false)
-	if err != nil {
-		return nil, fmt.Errorf("compute remote secret: %w", err)
+	start := epochStart(t, o.epoch)
+	location := &Location{
+		PSK:       psk,
+		StartsAt:  start,
+		ExpiresAt: start.Add(o.epoch),
+		Protocol:  o.protocol,
+		Clock:     o.clock,
+	}
+	switch o.protocol {
+	case ProtocolV1:
+		localsecret, err := computeSecret(start, o.epoch, psk, true)
+		if err != nil {
+			return nil, fmt.Errorf("compute local secret: %w", err)
+		}
+		remotesecret, err := computeSecret(start, o.epoch, psk, false)
+		if err != nil {
+			return nil, fmt.Errorf("compute remote secret: %w", err)
+		}
+		location.LocalSecret = fmt.Sprintf("%x", localsecret)
+		location.RemoteSecret = fmt.Sprintf("%x", remotesecret)
+		location.TURNServer = turnServers[localsecret[0]%byte(len(turnServers))]
+	case ProtocolV2:
+		location.LocalSecret = fmt.Sprintf("%x", location.derive(labelJoinSecret, 32))
+		location.RemoteSecret = fmt.Sprintf("%x", location.derive(labelWaitSecret, 32))
+		location.TURNServer = turnServers[location.deriveUint64(labelTURNServer)%uint64(len(turnServers))]
+	default:
+		return nil, fmt.Errorf("unsupported protocol %q", o.protocol)
 	}
-	mod := len(turnServers)
-	turnServer := turnServers[localsecret[0]%byte(mod)]
-	return &Location{
-		PSK:          psk,
-		LocalSecret:  fmt.Sprintf("%x", localsecret),
-		RemoteSecret: fmt.Sprintf("%x", remotesecret),
-		TURNServer:   turnServer,
-		ExpiresAt:    t.Add(time.Hour),
-	}, nil
+	return location, nil
 }
 
-// SessionID returns the session ID.
+// SessionID returns the session ID. It is derived from the epoch secret, so
+// it changes with every epoch.
 func (l *Location) SessionID() int {
+	if l.Protocol != ProtocolV1 {
+		// Keep within the 15 digits of the legacy session ID.
+		return int(l.deriveUint64(labelSessionID) % 1e15)
+	}
 	data := base64.StdEncoding.EncodeToString([]byte(l.LocalSecret))
 	sessionID := numericSession(data[0:15])
 	return sessionID
@@ -77,47 +150,91 @@ func (l *Location) SessionID() int {
 
 // TURNSessionID returns the TURN session ID.
 func (l *Location) TURNSessionID() string {
+	if l.Protocol != ProtocolV1 {
+		return l.deriveString(labelTURNSession, 12)
+	}
 	data := base64.StdEncoding.EncodeToString([]byte(l.RemoteSecret))
 	return data[0:15]
 }
 
-// LocalUfrag returns the local ufrag.
+// DataChannelLabel returns the label of the data channel the peers open. It
+// is derived from the secrets of the location, so it changes every epoch and
+// reveals nothing about the PSK.
+func (l *Location) DataChannelLabel() string {
+	if l.Protocol != ProtocolV1 {
+		return l.deriveString(labelDataChannel, 16)
+	}
+	sum := sha256.Sum256([]byte(labelDataChannel + l.LocalSecret + l.RemoteSecret))
+	return base64.RawStdEncoding.EncodeToString(sum[:16])
+}
+
+// LocalUfrag returns the ICE ufrag of this peer.
 func (l *Location) LocalUfrag() string {
-	data := base64.StdEncoding.EncodeToString([]byte(l.LocalSecret))
-	return data[15:19]
+	ufrag, _ := l.credentials(true)
+	return ufrag
 }
 
-// LocalPwd returns the local pwd.
+// LocalPwd returns the ICE pwd of this peer.
 func (l *Location) LocalPwd() string {
-	data := base64.StdEncoding.EncodeToString([]byte(l.LocalSecret))
-	return data[19:]
+	_, pwd := l.credentials(true)
+	return pwd
 }
 
-// RemoteUfrag returns the remote ufrag.
+// RemoteUfrag returns the ICE ufrag expected from the other peer.
 func (l *Location) RemoteUfrag() string {
-	data := base64.StdEncoding.EncodeToString([]byte(l.RemoteSecret))
-	return data[15:19]
+	ufrag, _ := l.credentials(false)
+	return ufrag
 }
 
-// RemotePwd returns the remote pwd.
+// RemotePwd returns the ICE pwd expected from the other peer.
 func (l *Location) RemotePwd() string {
-	data := base64.StdEncoding.EncodeToString([]byte(l.RemoteSecret))
-	return data[19:]
+	_, pwd := l.credentials(false)
+	return pwd
+}
+
+// credentials returns the local or remote ICE credentials for the role of
+// this peer.
+func (l *Location) credentials(local bool) (ufrag, pwd string) {
+	if local != l.Waiting {
+		return l.joinCredentials()
+	}
+	if l.Protocol != ProtocolV1 {
+		return l.deriveString(labelWaitUfrag, 6), l.deriveString(labelWaitPwd, 24)
+	}
+	return secretCredentials(l.RemoteSecret)
+}
+
+// joinCredentials returns the ICE credentials of the joining peer.
+func (l *Location) joinCredentials() (ufrag, pwd string) {
+	if l.Protocol != ProtocolV1 {
+		return l.deriveString(labelJoinUfrag, 6), l.deriveString(labelJoinPwd, 24)
+	}
+	return secretCredentials(l.LocalSecret)
+}
+
+func secretCredentials(secret string) (ufrag, pwd string) {
+	data := base64.StdEncoding.EncodeToString([]byte(secret))
+	return data[15:19], data[19:]
 }
 
 // Expired returns a channel that is closed when the campfire expires.
 func (l *Location) Expired() <-chan struct{} {
+	clock := l.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
 	ch := make(chan struct{})
 	go func() {
-		<-time.After(time.Until(l.ExpiresAt))
+		<-clock.After(l.ExpiresAt.Sub(clock.Now()))
 		close(ch)
 	}()
 	return ch
 }
 
-func computeSecret(time time.Time, psk []byte, isLocal bool) ([]byte, error) {
+// computeSecret derives a secret for the epoch t falls in, as ProtocolV1 does.
+func computeSecret(t time.Time, epoch time.Duration, psk []byte, isLocal bool) ([]byte, error) {
 	plaintext := make([]byte, aes.BlockSize+len(psk))
-	timeStr := time.Format("2006-01-02 15:00:00")
+	timeStr := formatEpoch(epochStart(t, epoch), epoch, "2006-01-02 15:00:00")
 	copy(plaintext, timeStr)
 	block, err := aes.NewCipher(psk)
 	if err != nil {
@@ -8,14 +8,13 @@
 package campfire
 
 import (
+	"strconv"
 	"testing"
 	"time"
 )
 
 func FuzzFind(f *testing.F) {
-	Now = func() time.Time {
-		return time.Unix(0, 0)
-	}
+	clock := newFakeClock(time.Unix(0, 0))
 	testcases := []string{
 		// Some randomly generated 32 byte PSKs.
 		"E7gonE7TmwXJTaSzEkLqQx0Vcpimv0a0",
@@ -33,11 +32,11 @@ func FuzzFind(f *testing.F) {
 		f.Add([]byte(tc))
 	}
 	f.Fuzz(func(t *testing.T, psk []byte) {
-		resp1, err := Find(psk, []string{"turn:turn.example.com:3478"})
+		resp1, err := Find(psk, []string{"turn:turn.example.com:3478"}, WithClock(clock))
 		if err != nil {
 			t.Skip(err)
 		}
-		resp2, err := Find(psk, []string{"turn:turn.example.com:3478"})
+		resp2, err := Find(psk, []string{"turn:turn.example.com:3478"}, WithClock(clock))
 		if err != nil {
 			t.Skip(err)
 		}
@@ -52,3 +51,181 @@ func FuzzFind(f *testing.F) {
 		}
 	})
 }
+
+func TestLocationCredentials(t *testing.T) {
+	join, err := Find([]byte(MustGeneratePSK()), []string{"turn:turn.example.com:3478"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait := *join
+	wait.Waiting = true
+	if join.LocalUfrag() != wait.RemoteUfrag() || join.LocalPwd() != wait.RemotePwd() {
+		t.Fatal("expected the joining peer's local credentials to be the waiting peer's remote credentials")
+	}
+	if join.RemoteUfrag() != wait.LocalUfrag() || join.RemotePwd() != wait.LocalPwd() {
+		t.Fatal("expected the waiting peer's local credentials to be the joining peer's remote credentials")
+	}
+	if join.LocalUfrag() == join.RemoteUfrag() && join.LocalPwd() == join.RemotePwd() {
+		t.Fatal("expected distinct credentials for each peer")
+	}
+	if join.TURNSessionID() != wait.TURNSessionID() || join.SessionID() != wait.SessionID() {
+		t.Fatal("expected both peers to share the session")
+	}
+	if len(join.LocalUfrag()) < 4 || len(join.LocalPwd()) < 22 {
+		t.Fatalf("ICE credentials too short: %q/%q", join.LocalUfrag(), join.LocalPwd())
+	}
+}
+
+func TestFindCandidates(t *testing.T) {
+	psk := MustGeneratePSK()
+	candidates, err := FindCandidates(psk, []string{"turn:turn.example.com:3478"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 3 {
+		t.Fatalf("expected 3 candidates, got %d", len(candidates))
+	}
+	for i, location := range candidates {
+		if location.ExpiresAt.Sub(location.StartsAt) != DefaultEpoch {
+			t.Fatalf("candidate %d: expected an epoch of %s, got %s", i, DefaultEpoch, location.ExpiresAt.Sub(location.StartsAt))
+		}
+		if i == 0 {
+			continue
+		}
+		if !candidates[i-1].ExpiresAt.Equal(location.StartsAt) {
+			t.Fatalf("candidate %d: expected to start at %s, got %s", i, candidates[i-1].ExpiresAt, location.StartsAt)
+		}
+		if candidates[i-1].LocalSecret == location.LocalSecret || candidates[i-1].RemoteSecret == location.RemoteSecret {
+			t.Fatalf("candidate %d: expected secrets to change between epochs", i)
+		}
+	}
+	// Any time within an epoch derives the same location.
+	start := candidates[1].StartsAt
+	for _, at := range []time.Time{start, start.Add(DefaultEpoch / 2), start.Add(DefaultEpoch - time.Nanosecond)} {
+		location, err := findAt(psk, []string{"turn:turn.example.com:3478"}, at, newOptions(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if location.LocalSecret != candidates[1].LocalSecret {
+			t.Fatalf("expected %s to derive the current epoch", at)
+		}
+	}
+}
+
+func TestFindEpoch(t *testing.T) {
+	psk := MustGeneratePSK()
+	servers := []string{"turn:turn.example.com:3478"}
+	hourly, err := Find(psk, servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	short, err := Find(psk, servers, WithEpoch(10*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := short.ExpiresAt.Sub(short.StartsAt); d != 10*time.Minute {
+		t.Fatalf("expected an epoch of 10m, got %s", d)
+	}
+	if short.LocalSecret == hourly.LocalSecret {
+		t.Fatal("expected epochs of different lengths to derive different secrets")
+	}
+	// An epoch of the same length spelled differently is the same epoch.
+	same, err := Find(psk, servers, WithEpoch(60*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same.LocalSecret != hourly.LocalSecret {
+		t.Fatal("expected 60m to derive the default epoch")
+	}
+	if _, err := Find(psk, servers, WithEpoch(time.Second)); err == nil {
+		t.Fatal("expected an epoch below the minimum to be rejected")
+	}
+}
+
+func TestFindProtocolV1(t *testing.T) {
+	// Values derived by the original /campfire/1.0.0 implementation.
+	at := time.Date(2023, 10, 1, 12, 30, 0, 0, time.UTC)
+	location, err := findAt([]byte("abcdefghijklmnopqrstuvwx12345678"), []string{"a", "b", "c"}, at, newOptions([]Option{WithProtocol(ProtocolV1)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{
+		location.TURNServer,
+		location.LocalSecret[:16],
+		location.RemoteSecret[:16],
+		strconv.Itoa(location.SessionID()),
+		location.TURNSessionID(),
+		location.LocalUfrag(),
+		location.LocalPwd()[:10],
+		location.RemoteUfrag(),
+		location.RemotePwd()[:10],
+	}
+	want := []string{"c", "054a38c0b3bab1b5", "a58d72a3e8d54094", "785894729265704", "YTU4ZDcyYTNlOGQ", "hYjF", "iNTllNGFjY", "1NDA", "5NGRkYWZhZ"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestFindProtocolV2(t *testing.T) {
+	psk := MustGeneratePSK()
+	servers := []string{"turn:turn.example.com:3478"}
+	v1, err := Find(psk, servers, WithProtocol(ProtocolV1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := Find(psk, servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2.Protocol != ProtocolV2 {
+		t.Fatalf("expected %s by default, got %s", ProtocolV2, v2.Protocol)
+	}
+	if v1.TURNSessionID() == v2.TURNSessionID() || v1.LocalUfrag() == v2.LocalUfrag() {
+		t.Fatal("expected protocol versions to derive different locations")
+	}
+	// Every value is derived under its own label.
+	values := map[string]bool{}
+	for _, v := range []string{v2.TURNSessionID(), v2.LocalUfrag(), v2.LocalPwd(), v2.RemoteUfrag(), v2.RemotePwd(), v2.LocalSecret, v2.RemoteSecret} {
+		if values[v] {
+			t.Fatalf("expected distinct derived values, got %q twice", v)
+		}
+		values[v] = true
+	}
+	if len(v2.LocalUfrag()) < 4 || len(v2.LocalPwd()) < 22 {
+		t.Fatalf("ICE credentials too short: %q/%q", v2.LocalUfrag(), v2.LocalPwd())
+	}
+	if _, err := Find(psk, servers, WithProtocol("/campfire/0.0.0")); err == nil {
+		t.Fatal("expected an unsupported protocol to be rejected")
+	}
+}
+
+func TestLocationDataChannelLabel(t *testing.T) {
+	psk := MustGeneratePSK()
+	for _, protocol := range []string{ProtocolV1, ProtocolV2} {
+		location, err := Find(psk, []string{"turn:127.0.0.1:1"}, WithProtocol(protocol))
+		if err != nil {
+			t.Fatal(err)
+		}
+		waiting := *location
+		waiting.Waiting = true
+		if location.DataChannelLabel() != waiting.DataChannelLabel() {
+			t.Fatalf("%s: expected both peers to agree on the data channel label", protocol)
+		}
+		next, err := findAt(psk, []string{"turn:127.0.0.1:1"}, location.ExpiresAt, newOptions([]Option{WithProtocol(protocol)}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next.DataChannelLabel() == location.DataChannelLabel() {
+			t.Fatalf("%s: expected the data channel label to change every epoch", protocol)
+		}
+		other, err := Find(MustGeneratePSK(), []string{"turn:127.0.0.1:1"}, WithProtocol(protocol))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other.DataChannelLabel() == location.DataChannelLabel() {
+			t.Fatalf("%s: expected campfires to have different data channel labels", protocol)
+		}
+	}
+}
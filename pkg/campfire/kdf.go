@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Labels of the values derived by ProtocolV2. Every value is derived from
+// the PSK and the epoch under its own label, so learning one of them reveals
+// nothing about the others.
+const (
+	labelJoinSecret  = "join secret"
+	labelWaitSecret  = "wait secret"
+	labelSessionID   = "session id"
+	labelTURNSession = "turn session id"
+	labelJoinUfrag   = "join ufrag"
+	labelJoinPwd     = "join pwd"
+	labelWaitUfrag   = "wait ufrag"
+	labelWaitPwd     = "wait pwd"
+	labelTURNServer  = "turn server"
+	labelDataChannel = "data channel label"
+	// labelTemporalKey prefixes the labels of CampfireURI temporal keys.
+	labelTemporalKey = "temporal key "
+)
+
+// deriveKey derives size bytes for the label from the PSK and the epoch
+// starting at start with HKDF-SHA256.
+func deriveKey(psk []byte, start time.Time, epoch time.Duration, label string, size int) []byte {
+	salt := []byte(fmt.Sprintf("%s %d %s", ProtocolV2, start.Unix(), epoch))
+	out := make([]byte, size)
+	// HKDF only fails when more than 255 hashes worth of output are read.
+	if _, err := io.ReadFull(hkdf.New(sha256.New, psk, salt, []byte(label)), out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// derive derives size bytes for the label at the location.
+func (l *Location) derive(label string, size int) []byte {
+	return deriveKey(l.PSK, l.StartsAt, l.ExpiresAt.Sub(l.StartsAt), label, size)
+}
+
+// deriveString derives a string of ICE characters for the label.
+func (l *Location) deriveString(label string, size int) string {
+	return base64.RawStdEncoding.EncodeToString(l.derive(label, size))
+}
+
+// deriveUint64 derives an integer for the label.
+func (l *Location) deriveUint64(label string) uint64 {
+	return binary.BigEndian.Uint64(l.derive(label, 8))
+}
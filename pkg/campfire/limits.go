@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// DefaultMaxHandshakes is the number of handshakes a waiting peer runs
+	// at once.
+	DefaultMaxHandshakes = 16
+	// DefaultMaxHandshakesPerAddress is the number of handshakes a waiting
+	// peer runs at once with peers advertising the same address.
+	DefaultMaxHandshakesPerAddress = 4
+	// handshakeTimeout is how long a connected peer has to open its data
+	// channel and prove it knows the code of the campfire before its
+	// handshake is given up.
+	handshakeTimeout = 2 * codeTimeout
+)
+
+var (
+	// ErrTooManyHandshakes is reported when a peer is turned away because
+	// too many handshakes are in progress.
+	ErrTooManyHandshakes = errors.New("too many handshakes in progress")
+	// ErrTooManyPeers is reported when a peer is turned away because the
+	// campfire has as many peers as it takes.
+	ErrTooManyPeers = errors.New("too many peers")
+	// ErrHandshakeTimeout is reported when a connected peer does not open its
+	// data channel in time.
+	ErrHandshakeTimeout = errors.New("handshake timed out")
+)
+
+// admit reserves a handshake for the offer, or returns why the peer is
+// turned away. The reservation is held until the peer is added or rejected.
+func (t *turnWait) admit(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.handshakes[id]; ok {
+		return fmt.Errorf("offer %s is already in progress", id)
+	}
+	if t.maxHandshakes > 0 && len(t.handshakes) >= t.maxHandshakes {
+		return ErrTooManyHandshakes
+	}
+	if t.maxPeers > 0 && len(t.peers)+len(t.handshakes) >= t.maxPeers {
+		return ErrTooManyPeers
+	}
+	t.handshakes[id] = make(map[string]bool)
+	return nil
+}
+
+// addCandidate adds a remote candidate to the handshake of the offer, unless
+// it makes too many handshakes come from the address of the candidate.
+// Candidates ruled out by the policy are ignored. t.mu must be held.
+func (t *turnWait) addCandidate(id string, pc *webrtc.PeerConnection, cand webrtc.ICECandidateInit) error {
+	if !t.opts.policy.allowsRemote(cand.Candidate) {
+		t.log.Debug("Ignoring remote ICE candidate ruled out by the policy", "candidate", cand.Candidate)
+		return nil
+	}
+	if addr := candidateAddress(cand.Candidate); addr != "" && t.maxHandshakesPerAddress > 0 {
+		addrs := t.handshakes[id]
+		if addrs != nil && !addrs[addr] {
+			n := 0
+			for _, other := range t.handshakes {
+				if other[addr] {
+					n++
+				}
+			}
+			if n >= t.maxHandshakesPerAddress {
+				return fmt.Errorf("%w from %s", ErrTooManyHandshakes, addr)
+			}
+			addrs[addr] = true
+		}
+	}
+	if err := pc.AddICECandidate(cand); err != nil {
+		t.log.Error("Error adding ice candidate", "error", err)
+	}
+	return nil
+}
+
+// reject turns the peer of the offer away.
+func (t *turnWait) reject(id string, pc *webrtc.PeerConnection, err error) {
+	t.log.Debug("Peer rejected", "id", id, "err", err)
+	t.forget(id)
+	if pc != nil {
+		go pc.Close()
+	}
+	t.sendEvent(Event{Type: EventPeerRejected, Peer: PeerInfo{ID: id}, Err: err})
+}
+
+// candidateAddress returns the address a remote ICE candidate reveals about
+// the peer: the address of host and server reflexive candidates, and the
+// related address of relayed ones, which is that of the peer rather than of
+// the TURN server.
+func candidateAddress(candidate string) string {
+	fields := strings.Fields(strings.TrimPrefix(candidate, "candidate:"))
+	if len(fields) < 8 || fields[6] != "typ" {
+		return ""
+	}
+	if fields[7] == "relay" {
+		for i := 8; i+1 < len(fields); i += 2 {
+			if fields[i] == "raddr" {
+				return fields[i+1]
+			}
+		}
+	}
+	return fields[4]
+}
@@ -0,0 +1,397 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestCandidateAddress(t *testing.T) {
+	tcs := map[string]string{
+		"candidate:1966762134 1 udp 2130706431 192.168.1.2 50000 typ host":                                  "192.168.1.2",
+		"candidate:3052 1 udp 1694498815 203.0.113.7 61000 typ srflx raddr 192.168.1.2 rport 50000":         "203.0.113.7",
+		"candidate:842 1 udp 16777215 198.51.100.1 49152 typ relay raddr 203.0.113.7 rport 61000":           "203.0.113.7",
+		"candidate:1 1 tcp 1518280447 7c1ab0e4-6d0f-4d1e-8d43-86b7fd6e0c2a.local 9 typ host tcptype active": "7c1ab0e4-6d0f-4d1e-8d43-86b7fd6e0c2a.local",
+		"":                      "",
+		"candidate:1 1 udp 1 x": "",
+	}
+	for candidate, want := range tcs {
+		if got := candidateAddress(candidate); got != want {
+			t.Errorf("candidateAddress(%q) = %q, expected %q", candidate, got, want)
+		}
+	}
+}
+
+func TestWaitAdmission(t *testing.T) {
+	newWait := func(o *options) *turnWait {
+		return &turnWait{
+			opts:                    o,
+			peers:                   make(map[string]*Peer),
+			handshakes:              make(map[string]map[string]bool),
+			inProgress:              make(map[string]*webrtc.PeerConnection),
+			pending:                 make(map[string][]webrtc.ICECandidateInit),
+			log:                     slog.Default(),
+			maxHandshakes:           o.maxHandshakes,
+			maxHandshakesPerAddress: o.maxHandshakesPerAddress,
+			maxPeers:                o.maxPeers,
+		}
+	}
+
+	w := newWait(newOptions([]Option{WithMaxHandshakes(2, 1)}))
+	if err := w.admit("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.admit("a"); err == nil {
+		t.Fatal("expected a repeated offer to be turned away")
+	}
+	if err := w.admit("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.admit("c"); !errors.Is(err, ErrTooManyHandshakes) {
+		t.Fatalf("expected %v, got %v", ErrTooManyHandshakes, err)
+	}
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	host := webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 2130706431 192.168.1.2 50000 typ host"}
+	w.mu.Lock()
+	if err := w.addCandidate("a", pc, host); err != nil {
+		t.Fatal(err)
+	}
+	// The same address may be advertised again by the same offer.
+	if err := w.addCandidate("a", pc, host); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.addCandidate("b", pc, host); !errors.Is(err, ErrTooManyHandshakes) {
+		t.Fatalf("expected %v, got %v", ErrTooManyHandshakes, err)
+	}
+	w.mu.Unlock()
+	// Finished handshakes make room for new ones.
+	w.forget("a")
+	if err := w.admit("c"); err != nil {
+		t.Fatal(err)
+	}
+	w.mu.Lock()
+	if err := w.addCandidate("b", pc, host); err != nil {
+		t.Fatal(err)
+	}
+	w.mu.Unlock()
+
+	w = newWait(newOptions([]Option{WithMaxPeers(1)}))
+	if err := w.admit("a"); err != nil {
+		t.Fatal(err)
+	}
+	// The handshake holds the only place until its peer is added.
+	if err := w.admit("b"); !errors.Is(err, ErrTooManyPeers) {
+		t.Fatalf("expected %v, got %v", ErrTooManyPeers, err)
+	}
+	newTestPeer := func(id string) *Peer {
+		return &Peer{Conn: &Conn{done: make(chan struct{})}, PeerInfo: PeerInfo{ID: id}}
+	}
+	if err := w.addPeer(newTestPeer("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := w.handshakes["a"]; ok {
+		t.Fatal("expected the handshake to be released once its peer is added")
+	}
+	if err := w.admit("b"); !errors.Is(err, ErrTooManyPeers) {
+		t.Fatalf("expected %v, got %v", ErrTooManyPeers, err)
+	}
+	if err := w.addPeer(newTestPeer("b")); !errors.Is(err, ErrTooManyPeers) {
+		t.Fatalf("expected %v, got %v", ErrTooManyPeers, err)
+	}
+}
+
+func TestWaitSingleUse(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, cf, peer, conn := connectTestCampfire(ctx, t, "maxpeers=1&", WithSingleUse())
+	if maxPeers := cf.(*turnWait).maxPeers; maxPeers != 1 {
+		t.Fatalf("expected maxpeers to limit the campfire to 1 peer, got %d", maxPeers)
+	}
+	if cf.Opened() {
+		t.Fatal("expected the campfire to close after the first peer")
+	}
+	// The accepted connection outlives the campfire.
+	if err := peer.WriteMessage([]byte("hello"), true); err != nil {
+		t.Fatal(err)
+	}
+	msg, _, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != "hello" {
+		t.Fatalf("expected 'hello' got %s", msg)
+	}
+}
+
+func TestWaitConcurrentJoins(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	camp, cert := newTestCamp(t, "maxpeers=1&")
+	cf, err := camp.Wait(ctx, WithCertificate(cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Close()
+	joinCtx, cancelJoins := context.WithCancel(ctx)
+	joined := make(chan *Conn, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			conn, _ := Join(joinCtx, camp)
+			joined <- conn
+		}()
+	}
+	defer func() {
+		cancelJoins()
+		for i := 0; i < 3; i++ {
+			if conn := <-joined; conn != nil {
+				conn.Close()
+			}
+		}
+	}()
+	peer, err := cf.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	// Only one of the overlapping handshakes takes the place of the campfire.
+	for rejected := 0; rejected < 2; {
+		select {
+		case event := <-cf.Events():
+			if event.Type != EventPeerRejected {
+				continue
+			}
+			if !errors.Is(event.Err, ErrTooManyPeers) {
+				t.Fatalf("expected %v, got %v", ErrTooManyPeers, event.Err)
+			}
+			rejected++
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+	}
+	if peers := cf.Peers(); len(peers) != 1 || peers[0].ID != peer.ID {
+		t.Fatalf("expected only the accepted peer, got %d peers", len(peers))
+	}
+}
+
+func TestWaitHandshakeTimeout(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	camp, cert := newTestCamp(t, "maxpeers=1&")
+	clock := newFakeClock(time.Now())
+	cf, err := camp.Wait(ctx, WithCertificate(cert), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Close()
+	tw := cf.(*turnWait)
+	handshakes := func() int {
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		return len(tw.handshakes) + len(tw.inProgress)
+	}
+	waitTimers(t, clock, 2)
+	connectWithoutDataChannel(ctx, t, camp, WithClock(clock))
+	if handshakes() == 0 {
+		t.Fatal("expected the connected peer to hold its handshake")
+	}
+	waitTimers(t, clock, 3)
+	clock.Advance(handshakeTimeout)
+	select {
+	case err := <-cf.Errors():
+		if !errors.Is(err, ErrHandshakeTimeout) {
+			t.Fatalf("expected %v, got %v", ErrHandshakeTimeout, err)
+		}
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+	if n := handshakes(); n != 0 {
+		t.Fatalf("expected the handshake to be given up, got %d", n)
+	}
+	// The place of the campfire is free again.
+	joinTestCampfire(ctx, t, camp, cf)
+}
+
+func TestWaitDrain(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	camp, cert := newTestCamp(t, "")
+	cf, err := camp.Wait(ctx, WithCertificate(cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Close()
+	tw := cf.(*turnWait)
+	joined := make(chan *Conn, 1)
+	go func() {
+		conn, _ := Join(ctx, camp)
+		joined <- conn
+	}()
+	for {
+		tw.mu.Lock()
+		n := len(tw.handshakes) + tw.handoffs
+		tw.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	// The handshake in progress still hands its peer to Accept.
+	tw.drain()
+	peer, err := cf.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	if conn := <-joined; conn == nil {
+		t.Fatal("expected the peer to join the draining campfire")
+	} else {
+		defer conn.Close()
+	}
+	waitFor(t, func() bool { return !cf.Opened() }, "expected the drained campfire to close")
+}
+
+func TestWaitDrainGracePeriod(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	camp, cert := newTestCamp(t, "")
+	clock := newFakeClock(time.Now())
+	cf, err := camp.Wait(ctx, WithCertificate(cert), WithClock(clock), WithGracePeriod(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Close()
+	connectWithoutDataChannel(ctx, t, camp, WithClock(clock))
+	n := clock.Timers()
+	cf.(*turnWait).drain()
+	waitTimers(t, clock, n+1)
+	if !cf.Opened() {
+		t.Fatal("expected the campfire to wait for its handshake")
+	}
+	// The handshake that never finishes is given up with the grace period.
+	clock.Advance(time.Second)
+	waitFor(t, func() bool { return !cf.Opened() }, "expected the campfire to close after the grace period")
+}
+
+// connectWithoutDataChannel connects to the campfire the way Join does, but
+// never opens the data channel the waiting peer accepts peers on. It returns
+// once the peer connection is connected.
+func connectWithoutDataChannel(ctx context.Context, t *testing.T, camp *CampfireURI, opts ...Option) {
+	t.Helper()
+	campOpts, err := camp.options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := newOptions(append(campOpts, opts...))
+	psk, err := camp.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, err := Find(psk, camp.TURNServers, WithEpoch(o.epoch), WithProtocol(o.protocol), WithClock(o.clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.NewString()
+	fireconn, err := o.newSignaler(ctx, camp, location, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fireconn.Close() })
+	s, err := o.newSettingEngine(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := webrtc.NewAPI(webrtc.WithSettingEngine(s)).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	// A negotiated data channel brings up SCTP without announcing a data
+	// channel to the waiting peer.
+	negotiated, channelID := true, uint16(0)
+	if _, err := pc.CreateDataChannel("hidden", &webrtc.DataChannelInit{Negotiated: &negotiated, ID: &channelID}); err != nil {
+		t.Fatal(err)
+	}
+	connected := make(chan struct{})
+	var connectedOnce sync.Once
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateConnected {
+			connectedOnce.Do(func() { close(connected) })
+		}
+	})
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c == nil {
+			return
+		}
+		_ = fireconn.SendCandidate(ctx, CampfireCandidate{ID: id, Ufrag: location.LocalUfrag(), Pwd: location.LocalPwd(), Cand: c.ToJSON()})
+	})
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	if err := fireconn.SendOffer(ctx, CampfireOffer{ID: id, Ufrag: location.LocalUfrag(), Pwd: location.LocalPwd(), SDP: offer}); err != nil {
+		t.Fatal(err)
+	}
+	var pending []webrtc.ICECandidateInit
+	for {
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case <-connected:
+			return
+		case answer := <-fireconn.Answers():
+			if answer.ID != id {
+				continue
+			}
+			if err := pc.SetRemoteDescription(answer.SDP); err != nil {
+				t.Fatal(err)
+			}
+			for _, cand := range pending {
+				_ = pc.AddICECandidate(cand)
+			}
+			pending = nil
+		case cand := <-fireconn.Candidates():
+			if cand.ID != id {
+				continue
+			}
+			if pc.RemoteDescription() == nil {
+				pending = append(pending, cand.Cand)
+				continue
+			}
+			_ = pc.AddICECandidate(cand.Cand)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+)
+
+// Listen waits for peers at the campfire and returns a net.Listener of their
+// connections, which can be handed to servers such as http.Server.Serve. The
+// DTLS certificate is set with WithCertificate.
+//
+// Unlike Wait, the listener does not expire with its epoch: a new campfire is
+// lit for the next epoch whenever the current one expires, until the
+// listener is closed or ctx is done. With WithSingleUse the listener closes
+// once it handed out the first peer.
+func Listen(ctx context.Context, camp *CampfireURI, opts ...Option) (net.Listener, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	cf, err := camp.Wait(ctx, opts...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	l := &listener{
+		camp:   camp,
+		opts:   opts,
+		cancel: cancel,
+		connc:  make(chan net.Conn),
+		closec: make(chan struct{}),
+		log:    newOptions(opts).logger.With("protocol", "campfire", "component", "campfire-listen"),
+	}
+	go l.run(ctx, cf)
+	return l, nil
+}
+
+type listener struct {
+	camp      *CampfireURI
+	opts      []Option
+	cancel    context.CancelFunc
+	connc     chan net.Conn
+	closec    chan struct{}
+	closeOnce sync.Once
+	err       error
+	log       *slog.Logger
+}
+
+// run hands out the connections of the campfire and lights the next one once
+// it expires.
+func (l *listener) run(ctx context.Context, cf CampfireChannel) {
+	for {
+		forwarded := make(chan struct{})
+		go func(cf CampfireChannel) {
+			defer close(forwarded)
+			l.forward(cf)
+		}(cf)
+		if !l.watch(cf, forwarded) {
+			cf.Close()
+			return
+		}
+		// Peers still connecting at the epoch boundary finish their
+		// handshakes with the expired campfire, which keeps forwarding them.
+		drain(cf)
+		next, err := l.camp.Wait(ctx, l.opts...)
+		if err != nil {
+			l.closeWithError(fmt.Errorf("relight campfire: %w", err))
+			return
+		}
+		cf = next
+	}
+}
+
+// drain closes the expired campfire once it has finished its handshakes in
+// progress, within the grace period, and stops it from taking new peers.
+func drain(cf CampfireChannel) {
+	if d, ok := cf.(interface{ drain() }); ok {
+		d.drain()
+		return
+	}
+	cf.Close()
+}
+
+// watch logs the errors of the campfire until it expires, and returns false
+// if the listener or the campfire was closed instead. A campfire that was put
+// out closes the listener once forwarded is closed, so the peers it accepted
+// last, like the one of a single-use campfire, are still handed to Accept.
+func (l *listener) watch(cf CampfireChannel, forwarded <-chan struct{}) bool {
+	expired := cf.Expired()
+	for {
+		select {
+		case <-l.closec:
+			return false
+		case err := <-cf.Errors():
+			l.log.Warn("Failed to connect to peer", "err", err)
+		case <-expired:
+			if !cf.Opened() {
+				// The campfire was put out, e.g. after a wrong code.
+				select {
+				case <-forwarded:
+				case <-l.closec:
+					return false
+				}
+				l.closeWithError(ErrClosed)
+				return false
+			}
+			return true
+		}
+	}
+}
+
+// forward hands the connections of the campfire to Accept until it closes.
+func (l *listener) forward(cf CampfireChannel) {
+	for {
+		conn, err := cf.Accept()
+		if err != nil {
+			return
+		}
+		select {
+		case l.connc <- conn:
+		case <-l.closec:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// Accept waits for and returns the next peer connection.
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.connc:
+		return conn, nil
+	case <-l.closec:
+		return nil, l.err
+	}
+}
+
+// Close stops listening. Connections already accepted stay open.
+func (l *listener) Close() error {
+	l.closeWithError(net.ErrClosed)
+	return nil
+}
+
+func (l *listener) closeWithError(err error) {
+	l.closeOnce.Do(func() {
+		l.err = err
+		close(l.closec)
+		l.cancel()
+	})
+}
+
+// Addr returns the campfire the listener waits at, without its PSK.
+func (l *listener) Addr() net.Addr {
+	return Addr{camp: l.camp}
+}
+
+// Addr is the address of a campfire.
+type Addr struct {
+	camp *CampfireURI
+}
+
+// Network returns "campfire".
+func (a Addr) Network() string { return "campfire" }
+
+// String returns the camp URI with its PSK removed.
+func (a Addr) String() string {
+	camp := *a.camp
+	camp.PSK = ""
+	return camp.EncodeURI()
+}
@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListen(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	camp, cert := newTestCamp(t, "")
+	l, err := Listen(ctx, camp, WithCertificate(cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := l.Addr().String(); strings.Contains(addr, camp.PSK) || !strings.Contains(addr, camp.PublicKeyFingerprint) {
+		t.Fatalf("unexpected listener address %s", addr)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello "+r.URL.Path[1:])
+	})}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(l)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return Join(ctx, camp)
+		},
+	}}
+	defer client.CloseIdleConnections()
+	for _, name := range []string{"world", "again"} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://campfire/"+name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "hello "+name {
+			t.Fatalf("expected 'hello %s' got %s", name, body)
+		}
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected %v, got %v", net.ErrClosed, err)
+	}
+}
+
+func TestListenSingleUse(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	camp, cert := newTestCamp(t, "")
+	l, err := Listen(ctx, camp, WithCertificate(cert), WithSingleUse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	conn, err := Join(ctx, camp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// The campfire is put out with the first peer, which is still handed
+	// to Accept before the listener closes.
+	time.Sleep(100 * time.Millisecond)
+	peer, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	if _, err := l.Accept(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected %v, got %v", ErrClosed, err)
+	}
+}
@@ -0,0 +1,233 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// DefaultGracePeriod is how long a waiting peer keeps listening at the
+// adjacent epochs around an epoch boundary.
+const DefaultGracePeriod = time.Minute
+
+// Option configures a campfire.
+type Option func(*options)
+
+type options struct {
+	protocol    string
+	epoch       time.Duration
+	gracePeriod time.Duration
+	clock       Clock
+	policy      Policy
+	certificate *webrtc.Certificate
+	authorizer  Authorizer
+
+	settingEngine *webrtc.SettingEngine
+	portMin       uint16
+	portMax       uint16
+	networkTypes  []webrtc.NetworkType
+	logger        *slog.Logger
+	signaler      SignalerFunc
+
+	maxHandshakes           int
+	maxHandshakesPerAddress int
+	maxPeers                int
+	singleUse               bool
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		protocol:    Protocol,
+		epoch:       DefaultEpoch,
+		gracePeriod: DefaultGracePeriod,
+		clock:       SystemClock,
+		policy:      PolicyAll,
+
+		maxHandshakes:           DefaultMaxHandshakes,
+		maxHandshakesPerAddress: DefaultMaxHandshakesPerAddress,
+		logger:                  slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// newSettingEngine returns the setting engine of the peer connections at the
+// location.
+func (o *options) newSettingEngine(location *Location) (webrtc.SettingEngine, error) {
+	var s webrtc.SettingEngine
+	if o.settingEngine != nil {
+		s = *o.settingEngine
+	} else {
+		s.SetIncludeLoopbackCandidate(true)
+	}
+	if o.portMin != 0 || o.portMax != 0 {
+		if err := s.SetEphemeralUDPPortRange(o.portMin, o.portMax); err != nil {
+			return s, fmt.Errorf("ICE port range: %w", err)
+		}
+	}
+	if len(o.networkTypes) > 0 {
+		s.SetNetworkTypes(o.networkTypes)
+	}
+	// Campfires cannot work without these.
+	s.DetachDataChannels()
+	s.SetICECredentials(location.LocalUfrag(), location.LocalPwd())
+	return s, nil
+}
+
+// newSignaler opens the signaler of the location, through the servers of the
+// camp URI unless WithSignaler says otherwise.
+func (o *options) newSignaler(ctx context.Context, camp *CampfireURI, location *Location, id string) (Signaler, error) {
+	if o.signaler != nil {
+		return o.signaler(ctx, location, id)
+	}
+	return camp.newSignaler(ctx, location, id, o.logger.With("protocol", "campfire"))
+}
+
+// WithGracePeriod sets how long before and after an epoch boundary a waiting
+// peer also listens at the adjacent epoch, to tolerate clock skew between
+// peers. A grace period of zero only listens at the current epoch.
+func WithGracePeriod(d time.Duration) Option {
+	return func(o *options) {
+		if d >= 0 {
+			o.gracePeriod = d
+		}
+	}
+}
+
+// WithEpoch sets the lifetime of a campfire location. Both peers must use the
+// same epoch, which is why it is normally taken from the camp URI.
+func WithEpoch(d time.Duration) Option {
+	return func(o *options) {
+		o.epoch = d
+	}
+}
+
+// WithClock sets the clock campfires are found, opened and expired by. It
+// defaults to SystemClock and is meant for tests that simulate time passing.
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		if clock != nil {
+			o.clock = clock
+		}
+	}
+}
+
+// WithPolicy sets the paths peers connect over. Join and Wait fail with
+// ErrPolicyUnsatisfiable if the servers of the camp URI cannot satisfy it.
+// It is normally taken from the "policy" argument of the camp URI.
+func WithPolicy(policy Policy) Option {
+	return func(o *options) {
+		o.policy = policy
+	}
+}
+
+// WithProtocol sets the protocol version secrets are derived with, either
+// ProtocolV1 or ProtocolV2. Both peers must use the same version, which is
+// why it is normally taken from the camp URI.
+func WithProtocol(protocol string) Option {
+	return func(o *options) {
+		o.protocol = protocol
+	}
+}
+
+// WithCertificate sets the DTLS certificate of the waiting peer, which must
+// match a fingerprint pinned by the camp URI unless it accepts any
+// fingerprint.
+func WithCertificate(cert *webrtc.Certificate) Option {
+	return func(o *options) {
+		o.certificate = cert
+	}
+}
+
+// WithAuthorizer sets the Authorizer a waiting peer consults for every peer
+// that completed the DTLS handshake, before it is handed to Accept. Rejected
+// peers are reported as EventPeerRejected events rather than as errors.
+func WithAuthorizer(authorizer Authorizer) Option {
+	return func(o *options) {
+		o.authorizer = authorizer
+	}
+}
+
+// WithMaxHandshakes sets how many handshakes a waiting peer runs at once, and
+// how many of them may come from peers advertising the same address. Peers
+// beyond either limit are turned away. Zero lifts a limit.
+func WithMaxHandshakes(total, perAddress int) Option {
+	return func(o *options) {
+		o.maxHandshakes = total
+		o.maxHandshakesPerAddress = perAddress
+	}
+}
+
+// WithMaxPeers sets how many peers a waiting peer is connected to at once,
+// counting those still in their handshake. It defaults to the "maxpeers"
+// argument of the camp URI, zero means no limit.
+func WithMaxPeers(n int) Option {
+	return func(o *options) {
+		o.maxPeers = n
+	}
+}
+
+// WithSingleUse closes the campfire once the first peer is accepted, as
+// pairing two peers needs. The accepted connection stays open.
+func WithSingleUse() Option {
+	return func(o *options) {
+		o.singleUse = true
+	}
+}
+
+// SignalerFunc opens a signaler for a location. The waiting peer opens it
+// with an empty id.
+type SignalerFunc func(ctx context.Context, location *Location, id string) (Signaler, error)
+
+// WithSettingEngine sets the setting engine peer connections are built from.
+// Data channels are always detached and the ICE credentials always derived
+// from the location. Without it loopback candidates are included.
+func WithSettingEngine(s *webrtc.SettingEngine) Option {
+	return func(o *options) {
+		o.settingEngine = s
+	}
+}
+
+// WithICEPortRange limits the UDP ports of local ICE candidates.
+func WithICEPortRange(portMin, portMax uint16) Option {
+	return func(o *options) {
+		o.portMin = portMin
+		o.portMax = portMax
+	}
+}
+
+// WithNetworkTypes limits the network types of local ICE candidates.
+func WithNetworkTypes(types ...webrtc.NetworkType) Option {
+	return func(o *options) {
+		o.networkTypes = types
+	}
+}
+
+// WithLogger sets the logger of the campfire. It defaults to slog.Default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
+
+// WithSignaler sets how peers open a signaler for a location, replacing the
+// servers of the camp URI.
+func WithSignaler(signaler SignalerFunc) Option {
+	return func(o *options) {
+		o.signaler = signaler
+	}
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestOptions(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// The signaler replaces the servers of the camp URI.
+	_, httpServer := setupSignaling(t)
+	var signalers atomic.Int32
+	var mu sync.Mutex
+	var logs bytes.Buffer
+	s := &webrtc.SettingEngine{}
+	s.SetIncludeLoopbackCandidate(true)
+	opts := []Option{
+		WithSettingEngine(s),
+		WithICEPortRange(40000, 40100),
+		WithNetworkTypes(webrtc.NetworkTypeUDP4),
+		WithLogger(slog.New(slog.NewTextHandler(&lockedWriter{mu: &mu, w: &logs}, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+		WithSignaler(func(ctx context.Context, location *Location, id string) (Signaler, error) {
+			signalers.Add(1)
+			return DialSignaler(ctx, httpServer, location, id)
+		}),
+	}
+	_, _, _, conn := connectTestCampfire(ctx, t, "", opts...)
+	if signalers.Load() < 2 {
+		t.Fatalf("expected both peers to use the signaler, got %d", signalers.Load())
+	}
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok || addr.IP.To4() == nil || addr.Port < 40000 || addr.Port > 40100 {
+		t.Fatalf("expected a UDP4 address within the port range, got %s", conn.LocalAddr())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !bytes.Contains(logs.Bytes(), []byte("protocol=campfire")) {
+		t.Fatal("expected the campfire to log to the logger")
+	}
+}
+
+func TestOptionsSettingEngine(t *testing.T) {
+	location, err := Find(MustGeneratePSK(), []string{"turn:127.0.0.1:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newOptions([]Option{WithICEPortRange(2, 1)}).newSettingEngine(location); err == nil {
+		t.Fatal("expected an invalid port range to be rejected")
+	}
+	if _, err := newOptions(nil).newSettingEngine(location); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lockedWriter serializes writes to w.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  *bytes.Buffer
+}
+
+func (l *lockedWriter) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(b)
+}
@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// PeerInfo describes a peer that joined a campfire.
+type PeerInfo struct {
+	// ID is the ID of the offer the peer joined with.
+	ID string
+	// Fingerprint is the SHA-256 fingerprint of the DTLS certificate of the
+	// peer, in the form returned by CertificateFingerprint.
+	Fingerprint string
+	// CandidatePair is the selected ICE candidate pair, nil if it is not
+	// known.
+	CandidatePair *webrtc.ICECandidatePair
+	// ConnectedAt is when the connection to the peer was established.
+	ConnectedAt time.Time
+}
+
+// Peer is a connection to a peer that joined a campfire.
+type Peer struct {
+	*Conn
+	PeerInfo
+}
+
+// newPeer returns the peer of a connection accepted for an offer at the given
+// time.
+func newPeer(conn *Conn, id string, connectedAt time.Time) *Peer {
+	sum := sha256.Sum256(conn.pc.SCTP().Transport().GetRemoteCertificate())
+	info := PeerInfo{
+		ID:          id,
+		Fingerprint: strings.ToUpper(hex.EncodeToString(sum[:])),
+		ConnectedAt: connectedAt,
+	}
+	if local, remote := conn.selectedCandidates(); local != nil && remote != nil {
+		info.CandidatePair = &webrtc.ICECandidatePair{Local: local, Remote: remote}
+	}
+	return &Peer{Conn: conn, PeerInfo: info}
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Policy restricts the paths peers of a campfire connect over.
+type Policy string
+
+// Connection policies.
+const (
+	// PolicyAll connects peers over any path, directly or through a TURN
+	// relay, whichever ICE finds first.
+	PolicyAll Policy = "all"
+	// PolicyRelay only connects through a TURN relay, so the local
+	// addresses of a peer are never revealed to the other.
+	PolicyRelay Policy = "relay"
+	// PolicyDirect never connects through a TURN relay. Peers behind NATs
+	// need a STUN server to find a direct path.
+	PolicyDirect Policy = "direct"
+)
+
+// ErrPolicyUnsatisfiable is returned when the servers of a camp URI cannot
+// connect peers under the connection policy.
+var ErrPolicyUnsatisfiable = errors.New("connection policy cannot be satisfied")
+
+// ParsePolicy parses a connection policy. An empty string is PolicyAll.
+func ParsePolicy(s string) (Policy, error) {
+	switch policy := Policy(strings.ToLower(s)); policy {
+	case "":
+		return PolicyAll, nil
+	case PolicyAll, PolicyRelay, PolicyDirect:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unsupported policy %q", s)
+	}
+}
+
+// ICETransportPolicy returns the ICE transport policy local candidates are
+// gathered with.
+func (p Policy) ICETransportPolicy() webrtc.ICETransportPolicy {
+	if p == PolicyRelay {
+		return webrtc.ICETransportPolicyRelay
+	}
+	return webrtc.ICETransportPolicyAll
+}
+
+// iceServers returns the ICE servers of the camp URI peers may connect over
+// under the policy.
+func (p Policy) iceServers(camp *CampfireURI) ([]webrtc.ICEServer, error) {
+	switch p {
+	case PolicyRelay:
+		if len(camp.TURNServers) == 0 {
+			return nil, fmt.Errorf("%w: policy %q needs a TURN server", ErrPolicyUnsatisfiable, p)
+		}
+		// STUN servers only find direct paths.
+		return (&CampfireURI{TURNServers: camp.TURNServers}).GetICEServers()
+	case PolicyDirect:
+		return (&CampfireURI{STUNServers: camp.STUNServers}).GetICEServers()
+	case PolicyAll:
+		return camp.GetICEServers()
+	default:
+		return nil, fmt.Errorf("unsupported policy %q", p)
+	}
+}
+
+// configuration returns the configuration of the peer connections of the
+// campfire under the policy.
+func (p Policy) configuration(camp *CampfireURI) (webrtc.Configuration, error) {
+	iceServers, err := p.iceServers(camp)
+	if err != nil {
+		return webrtc.Configuration{}, err
+	}
+	return webrtc.Configuration{
+		ICEServers:         iceServers,
+		ICETransportPolicy: p.ICETransportPolicy(),
+	}, nil
+}
+
+// allowsRemote returns false for remote candidates of paths the policy rules
+// out: a direct policy does not use the relay of the other peer either.
+func (p Policy) allowsRemote(candidate string) bool {
+	return p != PolicyDirect || candidateType(candidate) != "relay"
+}
+
+// candidateType returns the type of an ICE candidate, e.g. "host" or "relay".
+func candidateType(candidate string) string {
+	fields := strings.Fields(strings.TrimPrefix(candidate, "candidate:"))
+	if len(fields) < 8 || fields[6] != "typ" {
+		return ""
+	}
+	return fields[7]
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestPolicyConfiguration(t *testing.T) {
+	camp, err := ParseCampfireURI("camp://fingerprint?0=turn:127.0.0.1:3478&1=stun:127.0.0.1:3479#abcdefghijklmnopqrstuvwx12345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcs := map[Policy]struct {
+		urls      []string
+		transport webrtc.ICETransportPolicy
+	}{
+		PolicyAll:    {urls: []string{"turn:127.0.0.1:3478", "stun:127.0.0.1:3479"}, transport: webrtc.ICETransportPolicyAll},
+		PolicyRelay:  {urls: []string{"turn:127.0.0.1:3478"}, transport: webrtc.ICETransportPolicyRelay},
+		PolicyDirect: {urls: []string{"stun:127.0.0.1:3479"}, transport: webrtc.ICETransportPolicyAll},
+	}
+	for policy, tc := range tcs {
+		config, err := policy.configuration(camp)
+		if err != nil {
+			t.Fatalf("%s: %v", policy, err)
+		}
+		var urls []string
+		for _, server := range config.ICEServers {
+			urls = append(urls, server.URLs...)
+		}
+		if len(urls) != len(tc.urls) {
+			t.Fatalf("%s: expected ICE servers %v, got %v", policy, tc.urls, urls)
+		}
+		for i := range urls {
+			if urls[i] != tc.urls[i] {
+				t.Fatalf("%s: expected ICE servers %v, got %v", policy, tc.urls, urls)
+			}
+		}
+		if config.ICETransportPolicy != tc.transport {
+			t.Fatalf("%s: expected transport policy %s, got %s", policy, tc.transport, config.ICETransportPolicy)
+		}
+	}
+
+	// A relay needs a TURN server.
+	stunOnly, err := ParseCampfireURI("camp://fingerprint?0=stun:127.0.0.1:3479#abcdefghijklmnopqrstuvwx12345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PolicyRelay.configuration(stunOnly); !errors.Is(err, ErrPolicyUnsatisfiable) {
+		t.Fatalf("expected %v, got %v", ErrPolicyUnsatisfiable, err)
+	}
+	if _, err := Policy("tor").configuration(camp); err == nil {
+		t.Fatal("expected an unsupported policy to fail")
+	}
+}
+
+func TestPolicyAllowsRemote(t *testing.T) {
+	host := "candidate:1966762134 1 udp 2130706431 192.168.1.2 50000 typ host"
+	relay := "candidate:842 1 udp 16777215 198.51.100.1 49152 typ relay raddr 203.0.113.7 rport 61000"
+	for _, policy := range []Policy{PolicyAll, PolicyRelay, PolicyDirect} {
+		if !policy.allowsRemote(host) {
+			t.Errorf("%s: expected host candidates to be allowed", policy)
+		}
+	}
+	if !PolicyRelay.allowsRemote(relay) || !PolicyAll.allowsRemote(relay) {
+		t.Error("expected relay candidates to be allowed")
+	}
+	if PolicyDirect.allowsRemote(relay) {
+		t.Error("expected a direct policy to rule out relay candidates")
+	}
+}
+
+func TestPolicyUnsatisfiable(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	wsServer, _ := setupSignaling(t)
+	cert, fingerprint := newTestCertificate(t)
+	camp, err := ParseCampfireURI("camp://" + fingerprint + "/?policy=relay&0=stun:127.0.0.1:1&1=" + wsServer + "#" + string(MustGeneratePSK()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := camp.Wait(ctx, WithCertificate(cert)); !errors.Is(err, ErrPolicyUnsatisfiable) {
+		t.Fatalf("wait: expected %v, got %v", ErrPolicyUnsatisfiable, err)
+	}
+	if _, err := Join(ctx, camp); !errors.Is(err, ErrPolicyUnsatisfiable) {
+		t.Fatalf("join: expected %v, got %v", ErrPolicyUnsatisfiable, err)
+	}
+	// An option overrides the camp URI.
+	camp, err = ParseCampfireURI("camp://" + fingerprint + "/?0=stun:127.0.0.1:1&1=" + wsServer + "#" + string(MustGeneratePSK()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Join(ctx, camp, WithPolicy(PolicyRelay)); !errors.Is(err, ErrPolicyUnsatisfiable) {
+		t.Fatalf("join: expected %v, got %v", ErrPolicyUnsatisfiable, err)
+	}
+}
+
+func TestPolicyDirect(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, _, peer, conn := connectTestCampfire(ctx, t, "policy=direct&")
+	if _, err := peer.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 5)
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[:n]) != "hello" {
+		t.Fatalf("expected 'hello' got %s", string(b[:n]))
+	}
+	if local, _ := conn.selectedCandidates(); local == nil || local.Typ == webrtc.ICECandidateTypeRelay {
+		t.Fatalf("expected a direct candidate pair, got %v", local)
+	}
+}
@@ -6,7 +6,14 @@
  */
 package campfire
 
-import "crypto/rand"
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
 
 var validPSKChars = []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
 
@@ -31,3 +38,110 @@ func MustGeneratePSK() []byte {
 	}
 	return psk
 }
+
+// KDF is the name of the password KDF used to stretch passphrases.
+const KDF = "argon2id"
+
+// Limits on the KDF parameters accepted from a camp URI, so a URI cannot make
+// a peer spend unbounded memory or time.
+const (
+	maxKDFTime    = 16
+	maxKDFMemory  = 1 << 20 // 1 GiB in KiB
+	maxKDFThreads = 64
+)
+
+// kdfSalt is the salt of passphrases that do not carry their own.
+const kdfSalt = "campfire passphrase"
+
+// KDFParams are the parameters of the password KDF that stretches a
+// passphrase into a PSK.
+type KDFParams struct {
+	// Time is the number of passes over the memory.
+	Time uint32
+	// Memory is the memory used in KiB.
+	Memory uint32
+	// Threads is the number of threads used.
+	Threads uint8
+	// Salt is an optional salt.
+	Salt string
+}
+
+// DefaultKDFParams are the KDF parameters used unless the camp URI sets
+// others, following the second recommendation of RFC 9106.
+var DefaultKDFParams = KDFParams{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// ParseKDFParams parses KDF parameters in the form used by the "kdf"
+// argument of a camp URI, e.g. "argon2id,t=3,m=65536,p=4,salt=example".
+// Parameters that are left out keep their default.
+func ParseKDFParams(s string) (KDFParams, error) {
+	params := DefaultKDFParams
+	fields := strings.Split(s, ",")
+	if fields[0] != KDF {
+		return params, fmt.Errorf("unsupported kdf %q", fields[0])
+	}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return params, fmt.Errorf("invalid kdf parameter %q", field)
+		}
+		if key == "salt" {
+			params.Salt = value
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return params, fmt.Errorf("invalid kdf parameter %q: %w", field, err)
+		}
+		switch key {
+		case "t":
+			params.Time = uint32(n)
+		case "m":
+			params.Memory = uint32(n)
+		case "p":
+			if n > maxKDFThreads {
+				return params, fmt.Errorf("invalid kdf parameter %q: at most %d threads", field, maxKDFThreads)
+			}
+			params.Threads = uint8(n)
+		default:
+			return params, fmt.Errorf("unknown kdf parameter %q", key)
+		}
+	}
+	return params, params.validate()
+}
+
+// String returns the parameters in the form accepted by ParseKDFParams.
+func (p KDFParams) String() string {
+	s := fmt.Sprintf("%s,t=%d,m=%d,p=%d", KDF, p.Time, p.Memory, p.Threads)
+	if p.Salt != "" {
+		s += ",salt=" + p.Salt
+	}
+	return s
+}
+
+func (p KDFParams) validate() error {
+	switch {
+	case p.Time < 1 || p.Time > maxKDFTime:
+		return fmt.Errorf("kdf time must be between 1 and %d", maxKDFTime)
+	case p.Threads < 1 || p.Threads > maxKDFThreads:
+		return fmt.Errorf("kdf threads must be between 1 and %d", maxKDFThreads)
+	case p.Memory < 8*uint32(p.Threads) || p.Memory > maxKDFMemory:
+		return fmt.Errorf("kdf memory must be between %d and %d KiB", 8*uint32(p.Threads), maxKDFMemory)
+	}
+	return nil
+}
+
+// StretchPSK stretches a passphrase or a key of any length into a PSK of
+// PSKSize bytes with Argon2id.
+func StretchPSK(passphrase []byte, params KDFParams) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase must not be empty")
+	}
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	salt := kdfSalt
+	if params.Salt != "" {
+		salt += " " + params.Salt
+	}
+	return argon2.IDKey(passphrase, []byte(salt), params.Time, params.Memory, params.Threads, PSKSize), nil
+}
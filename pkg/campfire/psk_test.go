@@ -8,14 +8,11 @@
 package campfire
 
 import (
+	"bytes"
 	"testing"
-	"time"
 )
 
 func FuzzGeneratePSK(f *testing.F) {
-	Now = func() time.Time {
-		return time.Unix(0, 0)
-	}
 	testcases := []string{
 		// Some randomly generated 32 byte PSKs.
 		string(MustGeneratePSK()),
@@ -48,3 +45,59 @@ func FuzzGeneratePSK(f *testing.F) {
 		seenPSKs[string(newPSK)] = struct{}{}
 	})
 }
+
+func TestStretchPSK(t *testing.T) {
+	params := KDFParams{Time: 1, Memory: 1024, Threads: 1}
+	psk, err := StretchPSK([]byte("correct horse battery staple"), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(psk) != PSKSize {
+		t.Fatalf("expected %d bytes, got %d", PSKSize, len(psk))
+	}
+	again, err := StretchPSK([]byte("correct horse battery staple"), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(psk, again) {
+		t.Fatal("expected the same passphrase to stretch into the same PSK")
+	}
+	salted := params
+	salted.Salt = "example"
+	for _, other := range []KDFParams{salted, {Time: 2, Memory: 1024, Threads: 1}} {
+		out, err := StretchPSK([]byte("correct horse battery staple"), other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(psk, out) {
+			t.Fatalf("expected %s to stretch into another PSK", other)
+		}
+	}
+	if _, err := Find(psk, []string{"turn:turn.example.com:3478"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := StretchPSK(nil, params); err == nil {
+		t.Fatal("expected an empty passphrase to be rejected")
+	}
+}
+
+func TestParseKDFParams(t *testing.T) {
+	params, err := ParseKDFParams("argon2id,t=1,m=1024,p=2,salt=example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (KDFParams{Time: 1, Memory: 1024, Threads: 2, Salt: "example"}); params != want {
+		t.Fatalf("expected %+v, got %+v", want, params)
+	}
+	if parsed, err := ParseKDFParams(params.String()); err != nil || parsed != params {
+		t.Fatalf("expected %s to round trip, got %+v, %v", params, parsed, err)
+	}
+	if params, err := ParseKDFParams("argon2id"); err != nil || params != DefaultKDFParams {
+		t.Fatalf("expected the defaults, got %+v, %v", params, err)
+	}
+	for _, invalid := range []string{"scrypt", "argon2id,t=0", "argon2id,m=4294967295", "argon2id,p=255", "argon2id,x=1", "argon2id,t"} {
+		if _, err := ParseKDFParams(invalid); err == nil {
+			t.Fatalf("expected %q to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package rendezvous
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// PacketMagic is the first byte of every rendezvous packet. It falls in a
+// range that is not used by STUN, TURN channel data, DTLS or RTP (RFC 7983),
+// so rendezvous packets can share a socket with a TURN server.
+const PacketMagic byte = 0xcf
+
+// PacketExpiry is how long a peer is kept after its last hello. Peers talking
+// over packets repeat their hello well within this interval.
+const PacketExpiry = 30 * time.Second
+
+// IsPacket returns true if b is a rendezvous packet.
+func IsPacket(b []byte) bool {
+	return len(b) > 1 && b[0] == PacketMagic
+}
+
+// MarshalPacket encodes the message as a rendezvous packet.
+func MarshalPacket(msg Message) ([]byte, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{PacketMagic}, data...), nil
+}
+
+// UnmarshalPacket decodes a rendezvous packet.
+func UnmarshalPacket(b []byte) (Message, error) {
+	var msg Message
+	if !IsPacket(b) {
+		return msg, ErrInvalidMessage
+	}
+	err := json.Unmarshal(b[1:], &msg)
+	return msg, err
+}
+
+// PacketServer serves the hub over a packet connection, identifying peers
+// by their address.
+type PacketServer struct {
+	hub     *Hub
+	conn    net.PacketConn
+	log     *slog.Logger
+	mu      sync.Mutex
+	clients map[string]*packetClient
+}
+
+type packetClient struct {
+	client   *Client
+	lastSeen time.Time
+}
+
+// NewPacketServer returns a packet server for the hub that replies through
+// conn.
+func NewPacketServer(hub *Hub, conn net.PacketConn) *PacketServer {
+	return &PacketServer{
+		hub:     hub,
+		conn:    conn,
+		log:     slog.Default().With("component", "rendezvous-packet-server"),
+		clients: make(map[string]*packetClient),
+	}
+}
+
+// Serve reads packets from the connection until it is closed.
+func (s *PacketServer) Serve() error {
+	defer s.Close()
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		s.HandlePacket(buf[:n], addr)
+	}
+}
+
+// HandlePacket handles a rendezvous packet received from addr.
+func (s *PacketServer) HandlePacket(b []byte, addr net.Addr) {
+	s.expire()
+	msg, err := UnmarshalPacket(b)
+	if err != nil {
+		s.log.Debug("dropping invalid packet", "addr", addr.String(), "err", err)
+		return
+	}
+	key := addr.String()
+	s.mu.Lock()
+	pc, ok := s.clients[key]
+	s.mu.Unlock()
+	switch {
+	case msg.Type == TypeHello && ok && pc.client.Hello().Session == msg.Session:
+		// A repeated hello keeps the peer alive.
+		s.mu.Lock()
+		pc.lastSeen = time.Now()
+		s.mu.Unlock()
+		s.reply(addr, Message{Type: TypeWelcome})
+	case msg.Type == TypeHello:
+		if ok {
+			s.drop(key)
+		}
+		client, err := s.hub.Register(msg)
+		if err != nil {
+			s.reply(addr, Message{Type: TypeError, Error: err.Error()})
+			return
+		}
+		s.mu.Lock()
+		s.clients[key] = &packetClient{client: client, lastSeen: time.Now()}
+		s.mu.Unlock()
+		go s.forward(client, addr)
+		s.reply(addr, Message{Type: TypeWelcome})
+	case !ok:
+		s.reply(addr, Message{Type: TypeError, Error: ErrInvalidHello.Error()})
+	case msg.Type == TypeBye:
+		s.drop(key)
+	default:
+		if err := pc.client.Send(msg); err != nil {
+			s.reply(addr, Message{Type: TypeError, ID: msg.ID, Error: err.Error()})
+		}
+	}
+}
+
+// Close unregisters every peer of the server.
+func (s *PacketServer) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, pc := range s.clients {
+		pc.client.Close()
+		delete(s.clients, key)
+	}
+}
+
+func (s *PacketServer) forward(client *Client, addr net.Addr) {
+	for {
+		select {
+		case <-client.Done():
+			return
+		case msg := <-client.Messages():
+			s.reply(addr, msg)
+		}
+	}
+}
+
+func (s *PacketServer) reply(addr net.Addr, msg Message) {
+	b, err := MarshalPacket(msg)
+	if err != nil {
+		s.log.Error("failed to marshal packet", "err", err)
+		return
+	}
+	if _, err := s.conn.WriteTo(b, addr); err != nil {
+		s.log.Debug("failed to write packet", "addr", addr.String(), "err", err)
+	}
+}
+
+func (s *PacketServer) drop(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pc, ok := s.clients[key]; ok {
+		pc.client.Close()
+		delete(s.clients, key)
+	}
+}
+
+// expire removes the peers that stopped sending hellos.
+func (s *PacketServer) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, pc := range s.clients {
+		if time.Since(pc.lastSeen) > PacketExpiry {
+			pc.client.Close()
+			delete(s.clients, key)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+// Package rendezvous implements the signaling hub that relays offers, answers
+// and candidates between the peers meeting at a campfire.
+package rendezvous
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// Message types.
+const (
+	// TypeHello registers a peer with the hub.
+	TypeHello = "hello"
+	// TypeWelcome acknowledges a hello.
+	TypeWelcome = "welcome"
+	// TypeOffer carries an offer from a joining peer.
+	TypeOffer = "offer"
+	// TypeAnswer carries an answer from a waiting peer.
+	TypeAnswer = "answer"
+	// TypeCandidate carries an ICE candidate.
+	TypeCandidate = "candidate"
+	// TypeBye unregisters a peer from the hub.
+	TypeBye = "bye"
+	// TypeError reports a rejected message.
+	TypeError = "error"
+)
+
+// Peer roles.
+const (
+	// RoleJoin is the role of a peer joining a campfire.
+	RoleJoin = "join"
+	// RoleWait is the role of a peer waiting at a campfire.
+	RoleWait = "wait"
+)
+
+// clientBuffer is the number of messages queued for a slow client before
+// further messages are dropped.
+const clientBuffer = 64
+
+var (
+	// ErrClosed is returned when sending through a closed client.
+	ErrClosed = errors.New("rendezvous client closed")
+	// ErrInvalidHello is returned when a peer registers with a bad hello.
+	ErrInvalidHello = errors.New("invalid hello")
+	// ErrInvalidMessage is returned when a peer sends a message the hub
+	// does not relay.
+	ErrInvalidMessage = errors.New("invalid message")
+)
+
+// Message is a message exchanged with the hub.
+type Message struct {
+	// Type is the type of the message.
+	Type string `json:"type"`
+	// Session is the campfire session the peer is meeting at.
+	Session string `json:"session,omitempty"`
+	// Role is the role of the peer, sent with a hello.
+	Role string `json:"role,omitempty"`
+	// ID is the ID of the offer the message belongs to.
+	ID string `json:"id,omitempty"`
+	// Ufrag is the username fragment of the sending peer. In a hello it is
+	// the username fragment of the joining peers the session is meant for.
+	Ufrag string `json:"ufrag,omitempty"`
+	// Pwd is the password of the sending peer. In a hello it is the password
+	// of the joining peers the session is meant for.
+	Pwd string `json:"pwd,omitempty"`
+	// Payload is the SDP or candidate carried by the message.
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Error describes why a message was rejected.
+	Error string `json:"error,omitempty"`
+}
+
+// Hub routes messages between the peers of each session. Peers are only
+// paired when they present the same joining credentials, which both sides
+// derive from the pre-shared key. The hub itself never learns the key.
+type Hub struct {
+	mu       sync.Mutex
+	sessions map[string]map[*Client]struct{}
+	log      *slog.Logger
+}
+
+// NewHub returns a new hub.
+func NewHub() *Hub {
+	return &Hub{
+		sessions: make(map[string]map[*Client]struct{}),
+		log:      slog.Default().With("component", "rendezvous-hub"),
+	}
+}
+
+// Register registers the peer described by the hello with the hub.
+func (h *Hub) Register(hello Message) (*Client, error) {
+	if hello.Type != TypeHello || hello.Session == "" || hello.Ufrag == "" || hello.Pwd == "" {
+		return nil, ErrInvalidHello
+	}
+	switch hello.Role {
+	case RoleJoin:
+		if hello.ID == "" {
+			return nil, ErrInvalidHello
+		}
+	case RoleWait:
+	default:
+		return nil, ErrInvalidHello
+	}
+	c := &Client{
+		hub:    h,
+		hello:  hello,
+		msgs:   make(chan Message, clientBuffer),
+		closec: make(chan struct{}),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	peers, ok := h.sessions[hello.Session]
+	if !ok {
+		peers = make(map[*Client]struct{})
+		h.sessions[hello.Session] = peers
+	}
+	peers[c] = struct{}{}
+	return c, nil
+}
+
+// Sessions returns the number of sessions with registered peers.
+func (h *Hub) Sessions() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.sessions)
+}
+
+func (h *Hub) unregister(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	peers := h.sessions[c.hello.Session]
+	delete(peers, c)
+	if len(peers) == 0 {
+		delete(h.sessions, c.hello.Session)
+	}
+}
+
+// route delivers the message to the peers it is meant for.
+func (h *Hub) route(from *Client, msg Message) {
+	h.mu.Lock()
+	var to []*Client
+	for peer := range h.sessions[from.hello.Session] {
+		if peer != from && from.reaches(peer, msg) {
+			to = append(to, peer)
+		}
+	}
+	h.mu.Unlock()
+	for _, peer := range to {
+		peer.deliver(msg)
+	}
+}
+
+// Client is a peer registered with a hub.
+type Client struct {
+	hub       *Hub
+	hello     Message
+	msgs      chan Message
+	closec    chan struct{}
+	closeOnce sync.Once
+}
+
+// Hello returns the hello the client registered with.
+func (c *Client) Hello() Message { return c.hello }
+
+// Send relays the message to the other peers of the session.
+func (c *Client) Send(msg Message) error {
+	select {
+	case <-c.closec:
+		return ErrClosed
+	default:
+	}
+	switch {
+	case msg.Type == TypeOffer && c.hello.Role == RoleJoin:
+	case msg.Type == TypeAnswer && c.hello.Role == RoleWait:
+	case msg.Type == TypeCandidate:
+	default:
+		return ErrInvalidMessage
+	}
+	msg.Session = c.hello.Session
+	msg.Role = c.hello.Role
+	if c.hello.Role == RoleJoin {
+		// Joining peers can only speak for their own offer.
+		msg.ID = c.hello.ID
+		msg.Ufrag = c.hello.Ufrag
+		msg.Pwd = c.hello.Pwd
+	} else if msg.ID == "" {
+		return ErrInvalidMessage
+	}
+	c.hub.route(c, msg)
+	return nil
+}
+
+// Messages returns the channel of messages relayed to the client.
+func (c *Client) Messages() <-chan Message { return c.msgs }
+
+// Done returns a channel that is closed when the client is closed.
+func (c *Client) Done() <-chan struct{} { return c.closec }
+
+// Close unregisters the client from the hub.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closec)
+		c.hub.unregister(c)
+	})
+}
+
+// reaches returns true if the message from c is meant for peer.
+func (c *Client) reaches(peer *Client, msg Message) bool {
+	if peer.hello.Ufrag != c.hello.Ufrag || peer.hello.Pwd != c.hello.Pwd {
+		return false
+	}
+	if c.hello.Role == RoleJoin {
+		return peer.hello.Role == RoleWait
+	}
+	return peer.hello.Role == RoleJoin && peer.hello.ID == msg.ID
+}
+
+func (c *Client) deliver(msg Message) {
+	select {
+	case <-c.closec:
+	case c.msgs <- msg:
+	default:
+		c.hub.log.Warn("dropping message for slow peer", "session", c.hello.Session, "type", msg.Type)
+	}
+}
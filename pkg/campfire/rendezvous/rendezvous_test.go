@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package rendezvous
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHub(t *testing.T) {
+	hub := NewHub()
+	register := func(role, id, pwd string) *Client {
+		t.Helper()
+		c, err := hub.Register(Message{Type: TypeHello, Session: "session", Role: role, ID: id, Ufrag: "ufrag", Pwd: pwd})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(c.Close)
+		return c
+	}
+	waiter := register(RoleWait, "", "pwd")
+	joiner := register(RoleJoin, "a", "pwd")
+	other := register(RoleJoin, "b", "pwd")
+	stranger := register(RoleJoin, "c", "guess")
+
+	// Joiners cannot speak for another offer.
+	if err := joiner.Send(Message{Type: TypeOffer, ID: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(t, waiter); msg.ID != "a" || msg.Type != TypeOffer {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	// Peers presenting other credentials never reach the waiter.
+	if err := stranger.Send(Message{Type: TypeOffer}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-waiter.Messages():
+		t.Fatalf("message from a stranger reached the waiter: %+v", msg)
+	default:
+	}
+	if err := waiter.Send(Message{Type: TypeAnswer, ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(t, joiner); msg.Type != TypeAnswer {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	select {
+	case msg := <-other.Messages():
+		t.Fatalf("message leaked to another joiner: %+v", msg)
+	default:
+	}
+	if err := joiner.Send(Message{Type: TypeAnswer, ID: "a"}); !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected %v, got %v", ErrInvalidMessage, err)
+	}
+	if err := waiter.Send(Message{Type: TypeCandidate}); !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected %v, got %v", ErrInvalidMessage, err)
+	}
+	for _, hello := range []Message{
+		{Type: TypeOffer, Session: "session", Role: RoleWait, Ufrag: "ufrag", Pwd: "pwd"},
+		{Type: TypeHello, Role: RoleWait, Ufrag: "ufrag", Pwd: "pwd"},
+		{Type: TypeHello, Session: "session", Role: RoleWait},
+		{Type: TypeHello, Session: "session", Role: RoleJoin, Ufrag: "ufrag", Pwd: "pwd"},
+		{Type: TypeHello, Session: "session", Role: "lurk", Ufrag: "ufrag", Pwd: "pwd"},
+	} {
+		if _, err := hub.Register(hello); !errors.Is(err, ErrInvalidHello) {
+			t.Fatalf("expected %v for %+v, got %v", ErrInvalidHello, hello, err)
+		}
+	}
+	waiter.Close()
+	joiner.Close()
+	other.Close()
+	stranger.Close()
+	if n := hub.Sessions(); n != 0 {
+		t.Fatalf("expected no sessions, got %d", n)
+	}
+}
+
+func receive(t *testing.T, c *Client) Message {
+	t.Helper()
+	select {
+	case msg := <-c.Messages():
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for message")
+		return Message{}
+	}
+}
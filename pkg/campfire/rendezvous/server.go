@@ -0,0 +1,267 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package rendezvous
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// PollTimeout is how long a poll is held open when there are no
+	// messages for the peer.
+	PollTimeout = 20 * time.Second
+	// helloTimeout is how long a new connection has to send its hello.
+	helloTimeout = 10 * time.Second
+	// pollExpiry is how long a polling peer is kept without polling.
+	pollExpiry = 2 * PollTimeout
+	// maxMessageSize is the largest message accepted from a peer.
+	maxMessageSize = 64 * 1024
+)
+
+// Handler serves the hub over WebSocket and HTTP long polling.
+//
+// A WebSocket peer sends its hello as the first message and then exchanges
+// messages in both directions. An HTTP peer POSTs its hello to receive a
+// token, then POSTs messages, GETs queued messages and DELETEs to leave,
+// passing the token as the "token" query parameter.
+type Handler struct {
+	hub   *Hub
+	ws    websocket.Server
+	log   *slog.Logger
+	mu    sync.Mutex
+	polls map[string]*pollClient
+}
+
+type pollClient struct {
+	client   *Client
+	lastPoll time.Time
+}
+
+// pollSession is the reply to the hello of an HTTP peer.
+type pollSession struct {
+	Token string `json:"token"`
+}
+
+// NewHandler returns a handler serving the given hub.
+func NewHandler(hub *Hub) *Handler {
+	h := &Handler{
+		hub:   hub,
+		log:   slog.Default().With("component", "rendezvous-server"),
+		polls: make(map[string]*pollClient),
+	}
+	h.ws = websocket.Server{Handler: h.serveWebsocket}
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		h.ws.ServeHTTP(w, r)
+		return
+	}
+	h.expirePolls()
+	token := r.URL.Query().Get("token")
+	switch {
+	case r.Method == http.MethodPost && token == "":
+		h.handleHello(w, r)
+	case r.Method == http.MethodPost:
+		h.handleSend(w, r, token)
+	case r.Method == http.MethodGet && token != "":
+		h.handlePoll(w, r, token)
+	case r.Method == http.MethodDelete && token != "":
+		h.handleBye(w, token)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) serveWebsocket(ws *websocket.Conn) {
+	defer ws.Close()
+	ws.MaxPayloadBytes = maxMessageSize
+	var hello Message
+	_ = ws.SetReadDeadline(time.Now().Add(helloTimeout))
+	if err := websocket.JSON.Receive(ws, &hello); err != nil {
+		h.log.Debug("failed to read hello", "err", err)
+		return
+	}
+	_ = ws.SetReadDeadline(time.Time{})
+	client, err := h.hub.Register(hello)
+	if err != nil {
+		_ = websocket.JSON.Send(ws, Message{Type: TypeError, Error: err.Error()})
+		return
+	}
+	defer client.Close()
+	var writeMu sync.Mutex
+	send := func(msg Message) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return websocket.JSON.Send(ws, msg)
+	}
+	if err := send(Message{Type: TypeWelcome}); err != nil {
+		return
+	}
+	go func() {
+		defer ws.Close()
+		for {
+			select {
+			case <-client.Done():
+				return
+			case msg := <-client.Messages():
+				if err := send(msg); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	for {
+		var msg Message
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			return
+		}
+		if msg.Type == TypeBye {
+			return
+		}
+		if err := client.Send(msg); err != nil {
+			if err := send(Message{Type: TypeError, ID: msg.ID, Error: err.Error()}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (h *Handler) handleHello(w http.ResponseWriter, r *http.Request) {
+	var hello Message
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxMessageSize)).Decode(&hello); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	client, err := h.hub.Register(hello)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		client.Close()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(b)
+	h.mu.Lock()
+	h.polls[token] = &pollClient{client: client, lastPoll: time.Now()}
+	h.mu.Unlock()
+	writeJSON(w, pollSession{Token: token})
+}
+
+func (h *Handler) handleSend(w http.ResponseWriter, r *http.Request, token string) {
+	client, ok := h.pollClient(token)
+	if !ok {
+		http.Error(w, "unknown token", http.StatusNotFound)
+		return
+	}
+	var msg Message
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxMessageSize)).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := client.Send(msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handlePoll(w http.ResponseWriter, r *http.Request, token string) {
+	client, ok := h.pollClient(token)
+	if !ok {
+		http.Error(w, "unknown token", http.StatusNotFound)
+		return
+	}
+	msgs := []Message{}
+	timer := time.NewTimer(PollTimeout)
+	defer timer.Stop()
+	select {
+	case <-r.Context().Done():
+		return
+	case <-client.Done():
+		http.Error(w, "closed", http.StatusGone)
+		return
+	case <-timer.C:
+	case msg := <-client.Messages():
+		msgs = append(msgs, msg)
+		// Drain whatever else is already queued.
+	drain:
+		for len(msgs) < clientBuffer {
+			select {
+			case msg := <-client.Messages():
+				msgs = append(msgs, msg)
+			default:
+				break drain
+			}
+		}
+	}
+	h.touch(token)
+	writeJSON(w, msgs)
+}
+
+func (h *Handler) handleBye(w http.ResponseWriter, token string) {
+	h.mu.Lock()
+	p, ok := h.polls[token]
+	delete(h.polls, token)
+	h.mu.Unlock()
+	if ok {
+		p.client.Close()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) pollClient(token string) (*Client, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p, ok := h.polls[token]
+	if !ok {
+		return nil, false
+	}
+	p.lastPoll = time.Now()
+	return p.client, true
+}
+
+func (h *Handler) touch(token string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if p, ok := h.polls[token]; ok {
+		p.lastPoll = time.Now()
+	}
+}
+
+// expirePolls removes the HTTP peers that stopped polling.
+func (h *Handler) expirePolls() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for token, p := range h.polls {
+		if time.Since(p.lastPoll) > pollExpiry {
+			p.client.Close()
+			delete(h.polls, token)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// streamBacklog is the number of streams opened by the peer that are held
+// until they are accepted.
+const streamBacklog = 16
+
+// ErrNotSession is returned when a connection cannot carry streams, such as
+// a stream itself.
+var ErrNotSession = errors.New("connection does not carry streams")
+
+// Session opens streams to the peer of a connection. Every stream is a data
+// channel of the same peer connection, so streams share its ICE, DTLS and
+// SCTP association rather than setting up their own.
+type Session struct {
+	conn *Conn
+}
+
+// NewSession returns the session of a connection returned by Join or Accept.
+// The connection itself stays usable as the first stream.
+func NewSession(conn *Conn) (*Session, error) {
+	if conn.streams == nil {
+		return nil, ErrNotSession
+	}
+	return &Session{conn: conn}, nil
+}
+
+// OpenStream opens a stream to the peer. The label is handed to the peer with
+// the stream and init sets whether it is ordered and reliable, it may be nil
+// for an ordered, reliable stream.
+func (s *Session) OpenStream(ctx context.Context, label string, init *webrtc.DataChannelInit) (*Conn, error) {
+	dc, err := s.conn.pc.CreateDataChannel(label, init)
+	if err != nil {
+		return nil, fmt.Errorf("create data channel: %w", err)
+	}
+	openc := make(chan *Conn, 1)
+	errc := make(chan error, 1)
+	dc.OnOpen(func() {
+		rw, err := dc.Detach()
+		if err != nil {
+			errc <- fmt.Errorf("detach data channel: %w", err)
+			return
+		}
+		openc <- newStream(rw, dc, s.conn.pc)
+	})
+	select {
+	case stream := <-openc:
+		return stream, nil
+	case err := <-errc:
+		dc.Close()
+		return nil, err
+	case <-s.conn.done:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		dc.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// AcceptStream waits for and returns the next stream opened by the peer.
+func (s *Session) AcceptStream(ctx context.Context) (*Conn, error) {
+	select {
+	case stream := <-s.conn.streams:
+		return stream, nil
+	case <-s.conn.done:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close closes the connection and with it every stream.
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
+
+// queueStream hands a data channel opened by the peer to AcceptStream once it
+// is open, or closes it if too many are waiting to be accepted.
+func queueStream(dc *webrtc.DataChannel, pc *webrtc.PeerConnection, streams chan<- *Conn, log *slog.Logger) {
+	dc.OnOpen(func() {
+		rw, err := dc.Detach()
+		if err != nil {
+			log.Warn("Failed to detach stream", "label", dc.Label(), "err", err)
+			return
+		}
+		select {
+		case streams <- newStream(rw, dc, pc):
+		default:
+			log.Warn("Dropping stream, too many are waiting to be accepted", "label", dc.Label())
+			rw.Close()
+		}
+	})
+}
@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestSession(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, _, peer, conn := connectTestCampfire(ctx, t, "")
+	joining, err := NewSession(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer joining.Close()
+	waiting, err := NewSession(peer.Conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maxRetransmits := uint16(0)
+	ordered := false
+	inits := map[string]*webrtc.DataChannelInit{
+		"control": nil,
+		"logs":    {Ordered: &ordered, MaxRetransmits: &maxRetransmits},
+	}
+	for label, init := range inits {
+		stream, err := joining.OpenStream(ctx, label, init)
+		if err != nil {
+			t.Fatal(err)
+		}
+		remote, err := waiting.AcceptStream(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if remote.DataChannel().Label() != label {
+			t.Fatalf("expected stream %q, got %q", label, remote.DataChannel().Label())
+		}
+		if remote.DataChannel().Ordered() != (init == nil) {
+			t.Fatalf("expected stream %q to keep its ordering", label)
+		}
+		if _, err := NewSession(remote); !errors.Is(err, ErrNotSession) {
+			t.Fatalf("expected %v, got %v", ErrNotSession, err)
+		}
+		if _, err := stream.Write([]byte(label)); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 16)
+		n, err := remote.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b[:n]) != label {
+			t.Fatalf("expected %q got %q", label, b[:n])
+		}
+		// Closing a stream leaves the session open.
+		if err := stream.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first data channel is still a stream of its own.
+	if _, err := peer.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 5)
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[:n]) != "hello" {
+		t.Fatalf("expected 'hello' got %s", b[:n])
+	}
+
+	if err := waiting.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waiting.AcceptStream(ctx); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected %v, got %v", ErrClosed, err)
+	}
+}
@@ -0,0 +1,432 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"campfire/pkg/campfire/rendezvous"
+)
+
+// signalerHelloTimeout is how long a signaling server has to acknowledge
+// a new peer.
+const signalerHelloTimeout = 5 * time.Second
+
+// Signaler exchanges offers, answers and candidates with the other peers
+// at a campfire.
+type Signaler interface {
+	// SendOffer sends an offer to the waiting peers.
+	SendOffer(ctx context.Context, offer CampfireOffer) error
+	// SendAnswer sends an answer to the peer that sent the offer.
+	SendAnswer(ctx context.Context, answer CampfireAnswer) error
+	// SendCandidate sends an ICE candidate to the other side of the offer.
+	SendCandidate(ctx context.Context, cand CampfireCandidate) error
+	// Offers returns a channel of offers received from joining peers.
+	Offers() <-chan CampfireOffer
+	// Answers returns a channel of answers received from the waiting peer.
+	Answers() <-chan CampfireAnswer
+	// Candidates returns a channel of ICE candidates received from peers.
+	Candidates() <-chan CampfireCandidate
+	// Errors returns a channel of errors.
+	Errors() <-chan error
+	// Close closes the signaler.
+	Close() error
+}
+
+// DialSignaler opens a signaler to the given server for a peer at the
+// location. The id identifies the offer of a joining peer and is empty for
+// the waiting peer. WebSocket and HTTP servers must speak the rendezvous
+// protocol, any other server is treated as a TURN server with the campfire
+// extension.
+func DialSignaler(ctx context.Context, server string, location *Location, id string) (Signaler, error) {
+	return dialSignaler(ctx, server, location, id, slog.Default())
+}
+
+// dialSignaler opens a signaler like DialSignaler that logs to log.
+func dialSignaler(ctx context.Context, server string, location *Location, id string, log *slog.Logger) (Signaler, error) {
+	hello := helloFor(location, id)
+	lowerServer := strings.ToLower(server)
+	switch {
+	case strings.HasPrefix(lowerServer, "wss://") || strings.HasPrefix(lowerServer, "ws://"):
+		return dialWebsocketSignaler(ctx, server, hello, log)
+	case strings.HasPrefix(lowerServer, "http://") || strings.HasPrefix(lowerServer, "https://"):
+		return dialHTTPSignaler(ctx, server, hello, log)
+	default:
+		return dialTURNSignaler(ctx, server, hello, log)
+	}
+}
+
+// newSignaler opens a signaler for the given location. A joining peer uses
+// the first server that can be reached, while the waiting peer listens on
+// every reachable server so joiners can fall back freely.
+func (camp *CampfireURI) newSignaler(ctx context.Context, location *Location, id string, log *slog.Logger) (Signaler, error) {
+	var errs []error
+	var signalers []Signaler
+	for _, server := range camp.signalingServers(location) {
+		s, err := dialSignaler(ctx, server, location, id, log)
+		if err != nil {
+			log.Debug("Signaling server unreachable", "server", redactServer(server), "err", err)
+			errs = append(errs, fmt.Errorf("%s: %w", redactServer(server), err))
+			continue
+		}
+		if id != "" {
+			return s, nil
+		}
+		signalers = append(signalers, s)
+	}
+	switch len(signalers) {
+	case 0:
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("no reachable signaling server: %w", errors.Join(errs...))
+	case 1:
+		return signalers[0], nil
+	default:
+		return newMultiSignaler(signalers), nil
+	}
+}
+
+// signalingServers returns the servers to signal through in the order they
+// are tried: the WebSocket servers, then the HTTP servers, then the TURN
+// server selected for the location and finally the other TURN servers. The
+// order of the camp URI is kept within each type of server but not across
+// them.
+func (camp *CampfireURI) signalingServers(location *Location) []string {
+	var servers []string
+	servers = append(servers, camp.WebsocketServers...)
+	servers = append(servers, camp.HTTPServers...)
+	if location.TURNServer != "" {
+		servers = append(servers, location.TURNServer)
+	}
+	for _, server := range camp.TURNServers {
+		if server != location.TURNServer {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
+
+// redactServer removes any credentials from a server URL so it can be logged.
+func redactServer(server string) string {
+	if i := strings.LastIndex(server, "@"); i >= 0 {
+		scheme := ""
+		if j := strings.Index(server, "://"); j >= 0 && j < i {
+			scheme = server[:j+3]
+		} else if strings.HasPrefix(strings.ToLower(server), "turn:") {
+			scheme = server[:5]
+		}
+		return scheme + server[i+1:]
+	}
+	return server
+}
+
+func helloFor(location *Location, id string) rendezvous.Message {
+	ufrag, pwd := location.joinCredentials()
+	hello := rendezvous.Message{
+		Type:    rendezvous.TypeHello,
+		Session: location.TURNSessionID(),
+		Role:    rendezvous.RoleJoin,
+		ID:      id,
+		// Both sides present the joining credentials, so the server can pair
+		// them without learning the pre-shared key.
+		Ufrag: ufrag,
+		Pwd:   pwd,
+	}
+	if id == "" {
+		hello.Role = rendezvous.RoleWait
+	}
+	return hello
+}
+
+// rendezvousSignaler implements Signaler on top of a rendezvous transport.
+type rendezvousSignaler struct {
+	send       func(ctx context.Context, msg rendezvous.Message) error
+	closeFn    func() error
+	offers     chan CampfireOffer
+	answers    chan CampfireAnswer
+	candidates chan CampfireCandidate
+	errc       chan error
+	closec     chan struct{}
+	closeOnce  sync.Once
+	log        *slog.Logger
+}
+
+func newRendezvousSignaler(transport string, log *slog.Logger) *rendezvousSignaler {
+	return &rendezvousSignaler{
+		offers:     make(chan CampfireOffer, 10),
+		answers:    make(chan CampfireAnswer, 10),
+		candidates: make(chan CampfireCandidate, 64),
+		errc:       make(chan error, 10),
+		closec:     make(chan struct{}),
+		log:        log.With("component", "campfire-signaler", "transport", transport),
+	}
+}
+
+func (s *rendezvousSignaler) SendOffer(ctx context.Context, offer CampfireOffer) error {
+	payload, err := json.Marshal(offer.SDP)
+	if err != nil {
+		return err
+	}
+	return s.write(ctx, rendezvous.Message{
+		Type:    rendezvous.TypeOffer,
+		ID:      offer.ID,
+		Ufrag:   offer.Ufrag,
+		Pwd:     offer.Pwd,
+		Payload: payload,
+	})
+}
+
+func (s *rendezvousSignaler) SendAnswer(ctx context.Context, answer CampfireAnswer) error {
+	payload, err := json.Marshal(answer.SDP)
+	if err != nil {
+		return err
+	}
+	return s.write(ctx, rendezvous.Message{
+		Type:    rendezvous.TypeAnswer,
+		ID:      answer.ID,
+		Ufrag:   answer.Ufrag,
+		Pwd:     answer.Pwd,
+		Payload: payload,
+	})
+}
+
+func (s *rendezvousSignaler) SendCandidate(ctx context.Context, cand CampfireCandidate) error {
+	payload, err := json.Marshal(cand.Cand)
+	if err != nil {
+		return err
+	}
+	return s.write(ctx, rendezvous.Message{
+		Type:    rendezvous.TypeCandidate,
+		ID:      cand.ID,
+		Ufrag:   cand.Ufrag,
+		Pwd:     cand.Pwd,
+		Payload: payload,
+	})
+}
+
+func (s *rendezvousSignaler) write(ctx context.Context, msg rendezvous.Message) error {
+	select {
+	case <-s.closec:
+		return ErrClosed
+	default:
+	}
+	return s.send(ctx, msg)
+}
+
+func (s *rendezvousSignaler) Offers() <-chan CampfireOffer { return s.offers }
+
+func (s *rendezvousSignaler) Answers() <-chan CampfireAnswer { return s.answers }
+
+func (s *rendezvousSignaler) Candidates() <-chan CampfireCandidate { return s.candidates }
+
+func (s *rendezvousSignaler) Errors() <-chan error { return s.errc }
+
+func (s *rendezvousSignaler) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.closec)
+		if s.closeFn != nil {
+			err = s.closeFn()
+		}
+	})
+	return err
+}
+
+func (s *rendezvousSignaler) closed() bool {
+	select {
+	case <-s.closec:
+		return true
+	default:
+		return false
+	}
+}
+
+// dispatch hands a message received from the server to the matching channel.
+func (s *rendezvousSignaler) dispatch(msg rendezvous.Message) {
+	var err error
+	switch msg.Type {
+	case rendezvous.TypeOffer:
+		offer := CampfireOffer{ID: msg.ID, Ufrag: msg.Ufrag, Pwd: msg.Pwd}
+		if err = json.Unmarshal(msg.Payload, &offer.SDP); err == nil {
+			select {
+			case s.offers <- offer:
+			default:
+				s.log.Warn("dropping offer", "id", msg.ID)
+			}
+		}
+	case rendezvous.TypeAnswer:
+		answer := CampfireAnswer{ID: msg.ID, Ufrag: msg.Ufrag, Pwd: msg.Pwd}
+		if err = json.Unmarshal(msg.Payload, &answer.SDP); err == nil {
+			select {
+			case s.answers <- answer:
+			default:
+				s.log.Warn("dropping answer", "id", msg.ID)
+			}
+		}
+	case rendezvous.TypeCandidate:
+		cand := CampfireCandidate{ID: msg.ID, Ufrag: msg.Ufrag, Pwd: msg.Pwd}
+		if err = json.Unmarshal(msg.Payload, &cand.Cand); err == nil {
+			select {
+			case s.candidates <- cand:
+			default:
+				s.log.Warn("dropping candidate", "id", msg.ID)
+			}
+		}
+	case rendezvous.TypeError:
+		err = errors.New(msg.Error)
+	case rendezvous.TypeWelcome:
+	default:
+		s.log.Debug("ignoring unknown message", "type", msg.Type)
+	}
+	if err != nil {
+		s.sendErr(fmt.Errorf("signaling server: %w", err))
+	}
+}
+
+func (s *rendezvousSignaler) sendErr(err error) {
+	select {
+	case s.errc <- err:
+	default:
+		s.log.Error("dropping signaler error", "err", err)
+	}
+}
+
+// maxSignalerRoutes is the number of offers a multiSignaler remembers the
+// origin of.
+const maxSignalerRoutes = 1024
+
+// multiSignaler combines the signalers of every reachable server. Replies
+// to an offer go out through the signaler the offer arrived on.
+type multiSignaler struct {
+	signalers  []Signaler
+	offers     chan CampfireOffer
+	candidates chan CampfireCandidate
+	answers    chan CampfireAnswer
+	errc       chan error
+	closec     chan struct{}
+	closeOnce  sync.Once
+	mu         sync.Mutex
+	routes     map[string]Signaler
+}
+
+func newMultiSignaler(signalers []Signaler) *multiSignaler {
+	m := &multiSignaler{
+		signalers:  signalers,
+		offers:     make(chan CampfireOffer),
+		candidates: make(chan CampfireCandidate),
+		answers:    make(chan CampfireAnswer),
+		errc:       make(chan error),
+		closec:     make(chan struct{}),
+		routes:     make(map[string]Signaler),
+	}
+	for _, s := range signalers {
+		go m.forward(s)
+	}
+	return m
+}
+
+func (m *multiSignaler) forward(s Signaler) {
+	for {
+		select {
+		case <-m.closec:
+			return
+		case offer := <-s.Offers():
+			m.mu.Lock()
+			if len(m.routes) >= maxSignalerRoutes {
+				// Old offers have long been answered, start over.
+				m.routes = make(map[string]Signaler)
+			}
+			m.routes[offer.ID] = s
+			m.mu.Unlock()
+			select {
+			case m.offers <- offer:
+			case <-m.closec:
+				return
+			}
+		case answer := <-s.Answers():
+			select {
+			case m.answers <- answer:
+			case <-m.closec:
+				return
+			}
+		case cand := <-s.Candidates():
+			select {
+			case m.candidates <- cand:
+			case <-m.closec:
+				return
+			}
+		case err := <-s.Errors():
+			select {
+			case m.errc <- err:
+			case <-m.closec:
+				return
+			}
+		}
+	}
+}
+
+// route returns the signalers that reach the other side of the offer.
+func (m *multiSignaler) route(id string) []Signaler {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.routes[id]; ok {
+		return []Signaler{s}
+	}
+	return m.signalers
+}
+
+func (m *multiSignaler) SendOffer(ctx context.Context, offer CampfireOffer) error {
+	var errs []error
+	for _, s := range m.signalers {
+		errs = append(errs, s.SendOffer(ctx, offer))
+	}
+	return errors.Join(errs...)
+}
+
+func (m *multiSignaler) SendAnswer(ctx context.Context, answer CampfireAnswer) error {
+	var errs []error
+	for _, s := range m.route(answer.ID) {
+		errs = append(errs, s.SendAnswer(ctx, answer))
+	}
+	return errors.Join(errs...)
+}
+
+func (m *multiSignaler) SendCandidate(ctx context.Context, cand CampfireCandidate) error {
+	var errs []error
+	for _, s := range m.route(cand.ID) {
+		errs = append(errs, s.SendCandidate(ctx, cand))
+	}
+	return errors.Join(errs...)
+}
+
+func (m *multiSignaler) Offers() <-chan CampfireOffer { return m.offers }
+
+func (m *multiSignaler) Answers() <-chan CampfireAnswer { return m.answers }
+
+func (m *multiSignaler) Candidates() <-chan CampfireCandidate { return m.candidates }
+
+func (m *multiSignaler) Errors() <-chan error { return m.errc }
+
+func (m *multiSignaler) Close() error {
+	var errs []error
+	m.closeOnce.Do(func() {
+		close(m.closec)
+		for _, s := range m.signalers {
+			errs = append(errs, s.Close())
+		}
+	})
+	return errors.Join(errs...)
+}
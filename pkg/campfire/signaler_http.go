@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"campfire/pkg/campfire/rendezvous"
+)
+
+// httpPollRetry is how long a failed poll waits before polling again.
+const httpPollRetry = time.Second
+
+// httpSignaler talks to a rendezvous server over HTTP long polling.
+type httpSignaler struct {
+	*rendezvousSignaler
+	client *http.Client
+	server string
+	token  string
+}
+
+func dialHTTPSignaler(ctx context.Context, server string, hello rendezvous.Message, log *slog.Logger) (Signaler, error) {
+	h := &httpSignaler{
+		rendezvousSignaler: newRendezvousSignaler("http", log),
+		client:             &http.Client{Timeout: rendezvous.PollTimeout + 10*time.Second},
+		server:             server,
+	}
+	helloCtx, cancel := context.WithTimeout(ctx, signalerHelloTimeout)
+	defer cancel()
+	var session struct {
+		Token string `json:"token"`
+	}
+	if err := h.do(helloCtx, http.MethodPost, hello, &session); err != nil {
+		return nil, fmt.Errorf("send hello: %w", err)
+	}
+	h.token = session.Token
+	pollCtx, stopPolling := context.WithCancel(context.Background())
+	h.send = func(ctx context.Context, msg rendezvous.Message) error {
+		return h.do(ctx, http.MethodPost, msg, nil)
+	}
+	h.closeFn = func() error {
+		stopPolling()
+		byeCtx, cancel := context.WithTimeout(context.Background(), signalerHelloTimeout)
+		defer cancel()
+		return h.do(byeCtx, http.MethodDelete, nil, nil)
+	}
+	go h.poll(pollCtx)
+	return h, nil
+}
+
+func (h *httpSignaler) poll(ctx context.Context) {
+	for {
+		var msgs []rendezvous.Message
+		err := h.do(ctx, http.MethodGet, nil, &msgs)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			h.sendErr(fmt.Errorf("poll: %w", err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(httpPollRetry):
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			h.dispatch(msg)
+		}
+	}
+}
+
+// do sends a request to the server, encoding in and decoding the reply into out.
+func (h *httpSignaler) do(ctx context.Context, method string, in, out any) error {
+	u, err := url.Parse(h.server)
+	if err != nil {
+		return err
+	}
+	if h.token != "" {
+		q := u.Query()
+		q.Set("token", h.token)
+		u.RawQuery = q.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"log/slog"
+
+	"campfire/pkg/campfire/rendezvous"
+)
+
+// memoryHub routes messages between the memory signalers of this process.
+var memoryHub = rendezvous.NewHub()
+
+// NewMemorySignaler returns a signaler that only reaches peers in the same
+// process. It is meant for tests.
+func NewMemorySignaler(location *Location, id string) (Signaler, error) {
+	client, err := memoryHub.Register(helloFor(location, id))
+	if err != nil {
+		return nil, err
+	}
+	s := newRendezvousSignaler("memory", slog.Default())
+	s.send = func(ctx context.Context, msg rendezvous.Message) error {
+		return client.Send(msg)
+	}
+	s.closeFn = func() error {
+		client.Close()
+		return nil
+	}
+	go func() {
+		for {
+			select {
+			case <-client.Done():
+				return
+			case msg := <-client.Messages():
+				s.dispatch(msg)
+			}
+		}
+	}()
+	return s, nil
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+
+	"campfire/pkg/campfire/rendezvous"
+)
+
+func TestSignalers(t *testing.T) {
+	t.Parallel()
+	wsServer, httpServer := setupSignaling(t)
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { udp.Close() })
+	go rendezvous.NewPacketServer(rendezvous.NewHub(), udp).Serve()
+	turnServer := "turn:user:pass@" + udp.LocalAddr().String()
+
+	dialers := map[string]func(ctx context.Context, location *Location, id string) (Signaler, error){
+		"memory": func(ctx context.Context, location *Location, id string) (Signaler, error) {
+			return NewMemorySignaler(location, id)
+		},
+	}
+	for _, server := range []string{wsServer, httpServer, turnServer} {
+		server := server
+		dialers[server] = func(ctx context.Context, location *Location, id string) (Signaler, error) {
+			return DialSignaler(ctx, server, location, id)
+		}
+	}
+	for name, dial := range dialers {
+		dial := dial
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			location, err := Find(MustGeneratePSK(), []string{turnServer})
+			if err != nil {
+				t.Fatal(err)
+			}
+			waiter, err := dial(ctx, location, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer waiter.Close()
+			joiner, err := dial(ctx, location, "joiner")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer joiner.Close()
+			other, err := dial(ctx, location, "other")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer other.Close()
+
+			offer := CampfireOffer{ID: "joiner", Ufrag: location.LocalUfrag(), Pwd: location.LocalPwd(), SDP: webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: "offer"}}
+			if err := joiner.SendOffer(ctx, offer); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case got := <-waiter.Offers():
+				if got != offer {
+					t.Fatalf("expected %+v, got %+v", offer, got)
+				}
+			case <-ctx.Done():
+				t.Fatal("timed out waiting for offer")
+			}
+			answer := CampfireAnswer{ID: "joiner", SDP: webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "answer"}}
+			if err := waiter.SendAnswer(ctx, answer); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case got := <-joiner.Answers():
+				if got != answer {
+					t.Fatalf("expected %+v, got %+v", answer, got)
+				}
+			case <-ctx.Done():
+				t.Fatal("timed out waiting for answer")
+			}
+			cand := CampfireCandidate{ID: "joiner", Cand: webrtc.ICECandidateInit{Candidate: "candidate"}}
+			if err := joiner.SendCandidate(ctx, cand); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case got := <-waiter.Candidates():
+				if got.ID != cand.ID || got.Cand.Candidate != cand.Cand.Candidate {
+					t.Fatalf("expected %+v, got %+v", cand, got)
+				}
+			case <-ctx.Done():
+				t.Fatal("timed out waiting for candidate")
+			}
+			select {
+			case got := <-other.Answers():
+				t.Fatalf("answer leaked to another joiner: %+v", got)
+			case got := <-other.Offers():
+				t.Fatalf("offer leaked to another joiner: %+v", got)
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestNewSignalerFallback(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, httpServer := setupSignaling(t)
+	camp, err := ParseCampfireURI("camp://fingerprint/?0=turn:127.0.0.1:1&1=ws://127.0.0.1:1&2=" + httpServer + "#" + string(MustGeneratePSK()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, err := Find([]byte(camp.PSK), camp.TURNServers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	o := newOptions([]Option{WithLogger(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))})
+	s, err := o.newSignaler(ctx, camp, location, "joiner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, ok := s.(*httpSignaler); !ok {
+		t.Fatalf("expected to fall back to the HTTP server, got %T", s)
+	}
+	if !strings.Contains(logs.String(), "Signaling server unreachable") {
+		t.Fatalf("expected the unreachable server to be logged to the logger, got %q", logs.String())
+	}
+}
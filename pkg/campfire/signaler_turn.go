@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"campfire/pkg/campfire/rendezvous"
+)
+
+const (
+	// defaultTURNSignalPort is the port used for TURN servers without one.
+	defaultTURNSignalPort = "3478"
+	// turnHelloRetry is how often an unanswered hello is repeated.
+	turnHelloRetry = 500 * time.Millisecond
+)
+
+// dialTURNSignaler signals through a TURN server with the campfire
+// extension, which relays rendezvous packets sent to its listening port.
+func dialTURNSignaler(ctx context.Context, server string, hello rendezvous.Message, log *slog.Logger) (Signaler, error) {
+	addr, err := turnSignalAddr(server)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial turn server: %w", err)
+	}
+	helloPacket, err := rendezvous.MarshalPacket(hello)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	deadline := time.Now().Add(signalerHelloTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	buf := make([]byte, 64*1024)
+	for {
+		if time.Now().After(deadline) {
+			conn.Close()
+			return nil, errors.New("turn server does not support campfire signaling")
+		}
+		if _, err := conn.Write(helloPacket); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("send hello: %w", err)
+		}
+		retry := time.Now().Add(turnHelloRetry)
+		if retry.After(deadline) {
+			retry = deadline
+		}
+		_ = conn.SetReadDeadline(retry)
+		n, err := conn.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			conn.Close()
+			return nil, fmt.Errorf("receive welcome: %w", err)
+		}
+		welcome, err := rendezvous.UnmarshalPacket(buf[:n])
+		if err != nil {
+			continue
+		}
+		if welcome.Type != rendezvous.TypeWelcome {
+			conn.Close()
+			return nil, fmt.Errorf("hello rejected: %s", welcome.Error)
+		}
+		break
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	s := newRendezvousSignaler("turn", log)
+	s.send = func(ctx context.Context, msg rendezvous.Message) error {
+		b, err := rendezvous.MarshalPacket(msg)
+		if err != nil {
+			return err
+		}
+		_, err = conn.Write(b)
+		return err
+	}
+	s.closeFn = func() error {
+		if b, err := rendezvous.MarshalPacket(rendezvous.Message{Type: rendezvous.TypeBye}); err == nil {
+			_, _ = conn.Write(b)
+		}
+		return conn.Close()
+	}
+	go func() {
+		// Keep the registration alive on the server.
+		ticker := time.NewTicker(rendezvous.PacketExpiry / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.closec:
+				return
+			case <-ticker.C:
+				if _, err := conn.Write(helloPacket); err != nil && !s.closed() {
+					s.sendErr(fmt.Errorf("send hello: %w", err))
+				}
+			}
+		}
+	}()
+	go func() {
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if !s.closed() {
+					s.sendErr(fmt.Errorf("turn signaling: %w", err))
+				}
+				return
+			}
+			msg, err := rendezvous.UnmarshalPacket(buf[:n])
+			if err != nil {
+				continue
+			}
+			s.dispatch(msg)
+		}
+	}()
+	return s, nil
+}
+
+// turnSignalAddr returns the UDP address of a TURN server URL such as
+// turn:user:pass@host:port?transport=udp.
+func turnSignalAddr(server string) (string, error) {
+	addr := server
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		addr = addr[i+1:]
+	} else if i := strings.Index(addr, ":"); i >= 0 && strings.HasPrefix(strings.ToLower(addr), "turn") {
+		addr = addr[i+1:]
+	}
+	addr = strings.TrimPrefix(addr, "//")
+	if i := strings.Index(addr, "?"); i >= 0 {
+		addr = addr[:i]
+	}
+	if addr == "" {
+		return "", fmt.Errorf("invalid turn server %q", redactServer(server))
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), defaultTURNSignalPort)
+	}
+	return addr, nil
+}
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"campfire/pkg/campfire/rendezvous"
+)
+
+func dialWebsocketSignaler(ctx context.Context, server string, hello rendezvous.Message, log *slog.Logger) (Signaler, error) {
+	origin := "http" + strings.TrimPrefix(server, "ws")
+	config, err := websocket.NewConfig(server, origin)
+	if err != nil {
+		return nil, fmt.Errorf("websocket config: %w", err)
+	}
+	addr := config.Location.Host
+	if config.Location.Port() == "" {
+		addr = net.JoinHostPort(config.Location.Hostname(), "80")
+		if config.Location.Scheme == "wss" {
+			addr = net.JoinHostPort(config.Location.Hostname(), "443")
+		}
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial websocket: %w", err)
+	}
+	if config.Location.Scheme == "wss" {
+		conn = tls.Client(conn, &tls.Config{ServerName: config.Location.Hostname()})
+	}
+	deadline := time.Now().Add(signalerHelloTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("websocket handshake: %w", err)
+	}
+	if err := websocket.JSON.Send(ws, hello); err != nil {
+		ws.Close()
+		return nil, fmt.Errorf("send hello: %w", err)
+	}
+	var welcome rendezvous.Message
+	if err := websocket.JSON.Receive(ws, &welcome); err != nil {
+		ws.Close()
+		return nil, fmt.Errorf("receive welcome: %w", err)
+	}
+	if welcome.Type != rendezvous.TypeWelcome {
+		ws.Close()
+		return nil, fmt.Errorf("hello rejected: %s", welcome.Error)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	s := newRendezvousSignaler("websocket", log)
+	var writeMu sync.Mutex
+	s.send = func(ctx context.Context, msg rendezvous.Message) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if d, ok := ctx.Deadline(); ok {
+			_ = ws.SetWriteDeadline(d)
+			defer ws.SetWriteDeadline(time.Time{})
+		}
+		return websocket.JSON.Send(ws, msg)
+	}
+	s.closeFn = ws.Close
+	go func() {
+		for {
+			var msg rendezvous.Message
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				if !s.closed() {
+					s.sendErr(fmt.Errorf("websocket: %w", err))
+				}
+				return
+			}
+			s.dispatch(msg)
+		}
+	}()
+	return s, nil
+}
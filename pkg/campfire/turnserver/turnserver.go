@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+// Package turnserver implements a TURN server with the campfire extension,
+// which carries campfire signaling on the same port as the TURN relay.
+package turnserver
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/pion/turn/v2"
+
+	"campfire/pkg/campfire/rendezvous"
+)
+
+// DefaultRealm is the realm used when none is configured.
+const DefaultRealm = "campfire"
+
+// Options are options for a TURN server.
+type Options struct {
+	// PublicIP is the IP address advertised for relayed connections.
+	PublicIP string
+	// RelayAddressUDP is the address relayed connections are bound to.
+	RelayAddressUDP string
+	// ListenUDP is the address the server listens on.
+	ListenUDP string
+	// Realm is the realm of the server. Defaults to DefaultRealm.
+	Realm string
+	// Users maps the usernames allowed to allocate relays to their passwords.
+	Users map[string]string
+	// EnableCampfire enables campfire signaling on the listening port.
+	EnableCampfire bool
+}
+
+// Server is a TURN server.
+type Server struct {
+	turn    *turn.Server
+	conn    net.PacketConn
+	signals *rendezvous.PacketServer
+	log     *slog.Logger
+}
+
+// NewServer starts a new TURN server.
+func NewServer(opts *Options) (*Server, error) {
+	publicIP := net.ParseIP(opts.PublicIP)
+	if publicIP == nil {
+		return nil, fmt.Errorf("invalid public IP %q", opts.PublicIP)
+	}
+	relayAddress := opts.RelayAddressUDP
+	if relayAddress == "" {
+		relayAddress = "0.0.0.0"
+	}
+	realm := opts.Realm
+	if realm == "" {
+		realm = DefaultRealm
+	}
+	keys := make(map[string][]byte, len(opts.Users))
+	for user, pass := range opts.Users {
+		keys[user] = turn.GenerateAuthKey(user, realm, pass)
+	}
+	conn, err := net.ListenPacket("udp", opts.ListenUDP)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	s := &Server{
+		conn: conn,
+		log:  slog.Default().With("component", "turn-server"),
+	}
+	packetConn := conn
+	if opts.EnableCampfire {
+		s.signals = rendezvous.NewPacketServer(rendezvous.NewHub(), conn)
+		packetConn = &campfireConn{PacketConn: conn, signals: s.signals}
+	}
+	s.turn, err = turn.NewServer(turn.ServerConfig{
+		Realm: realm,
+		AuthHandler: func(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+			key, ok := keys[username]
+			if !ok {
+				s.log.Debug("rejecting unknown user", "user", username, "addr", srcAddr.String())
+			}
+			return key, ok
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{
+				PacketConn: packetConn,
+				RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+					RelayAddress: publicIP,
+					Address:      relayAddress,
+				},
+			},
+		},
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("new turn server: %w", err)
+	}
+	return s, nil
+}
+
+// ListenPort returns the UDP port the server listens on.
+func (s *Server) ListenPort() int {
+	return s.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// Close closes the server.
+func (s *Server) Close() error {
+	if s.signals != nil {
+		s.signals.Close()
+	}
+	return s.turn.Close()
+}
+
+// campfireConn passes campfire signaling to the rendezvous server and
+// everything else to the TURN server.
+type campfireConn struct {
+	net.PacketConn
+	signals *rendezvous.PacketServer
+	mu      sync.Mutex
+	buf     [64 * 1024]byte
+}
+
+func (c *campfireConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		// Signaling can be larger than the TURN MTU, so read into a buffer
+		// that fits any datagram.
+		n, addr, err := c.PacketConn.ReadFrom(c.buf[:])
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				c.signals.Close()
+			}
+			return 0, addr, err
+		}
+		if rendezvous.IsPacket(c.buf[:n]) {
+			c.signals.HandlePacket(c.buf[:n], addr)
+			continue
+		}
+		return copy(p, c.buf[:n]), addr, nil
+	}
+}
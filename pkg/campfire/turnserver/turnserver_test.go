@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package turnserver
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/turn/v2"
+
+	"campfire/pkg/campfire/rendezvous"
+)
+
+func TestServer(t *testing.T) {
+	server, err := NewServer(&Options{
+		PublicIP:        "127.0.0.1",
+		RelayAddressUDP: "127.0.0.1",
+		ListenUDP:       "127.0.0.1:0",
+		Users:           map[string]string{"user": "pass"},
+		EnableCampfire:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	addr := fmt.Sprintf("127.0.0.1:%d", server.ListenPort())
+
+	t.Run("Relay", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		client, err := turn.NewClient(&turn.ClientConfig{
+			STUNServerAddr: addr,
+			TURNServerAddr: addr,
+			Conn:           conn,
+			Username:       "user",
+			Password:       "pass",
+			Realm:          DefaultRealm,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		if err := client.Listen(); err != nil {
+			t.Fatal(err)
+		}
+		relay, err := client.Allocate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer relay.Close()
+		if ip := relay.LocalAddr().(*net.UDPAddr).IP; !ip.Equal(net.ParseIP("127.0.0.1")) {
+			t.Fatalf("expected relay on 127.0.0.1, got %s", ip)
+		}
+	})
+
+	t.Run("Signaling", func(t *testing.T) {
+		conn, err := net.Dial("udp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		hello, err := rendezvous.MarshalPacket(rendezvous.Message{
+			Type:    rendezvous.TypeHello,
+			Session: "session",
+			Role:    rendezvous.RoleWait,
+			Ufrag:   "ufrag",
+			Pwd:     "pwd",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write(hello); err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 1500)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := rendezvous.UnmarshalPacket(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != rendezvous.TypeWelcome {
+			t.Fatalf("expected welcome, got %+v", msg)
+		}
+	})
+}
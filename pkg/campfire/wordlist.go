@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Campfire Protocol
+ *
+ * Copyright (C) 2023 Michael Brooks <mike@flake.art>. All Rights Reserved.
+ * Written by Michael Brooks (mike@flake.art)
+ */
+
+package campfire
+
+// codeWords are the words of a campfire code. There are 256 of them, so
+// every word carries a byte of the code.
+var codeWords = [256]string{
+	"acorn", "actor", "adobe", "aisle", "alarm", "album", "alert", "alien",
+	"almond", "alpha", "amber", "anchor", "angle", "ankle", "apple", "apron",
+	"arctic", "arena", "armor", "arrow", "artist", "aspen", "atlas", "atom",
+	"attic", "audio", "autumn", "avocado", "axis", "bacon", "badge", "bagel",
+	"bakery", "bamboo", "banana", "banjo", "barn", "basil", "basket", "beacon",
+	"beetle", "bench", "berry", "bicycle", "bison", "blanket", "blossom", "boat",
+	"bonfire", "bottle", "boulder", "bracket", "breeze", "brick", "bridge", "bronze",
+	"brook", "bubble", "bucket", "buffalo", "bugle", "butter", "cabin", "cactus",
+	"camel", "canal", "candle", "canyon", "carbon", "cargo", "carpet", "castle",
+	"cedar", "cello", "cement", "cherry", "chess", "chimney", "cider", "cinnamon",
+	"circus", "citrus", "clover", "cobalt", "cocoa", "comet", "copper", "coral",
+	"cotton", "cradle", "crater", "crayon", "cricket", "crystal", "cupcake", "cyclone",
+	"daisy", "dancer", "delta", "denim", "desert", "diamond", "dinner", "dolphin",
+	"domino", "donkey", "dragon", "drum", "eagle", "easel", "echo", "eclipse",
+	"elbow", "ember", "emerald", "engine", "falcon", "feather", "fennel", "ferry",
+	"fiddle", "fig", "flannel", "flute", "fossil", "fountain", "fox", "galaxy",
+	"garden", "garlic", "gazelle", "geyser", "ginger", "glacier", "globe", "gopher",
+	"granite", "gravel", "guitar", "hammer", "harbor", "harvest", "hazel", "helmet",
+	"heron", "hickory", "honey", "horizon", "husky", "igloo", "indigo", "island",
+	"ivory", "jacket", "jaguar", "jasmine", "jelly", "jigsaw", "juniper", "kayak",
+	"kettle", "kiwi", "koala", "ladder", "lagoon", "lantern", "lemon", "lentil",
+	"lilac", "lobster", "locket", "lotus", "magnet", "mango", "maple", "marble",
+	"meadow", "melon", "meteor", "mitten", "mosaic", "muffin", "nectar", "nickel",
+	"noodle", "nutmeg", "oasis", "ocean", "olive", "onion", "orbit", "orchid",
+	"otter", "oyster", "paddle", "panda", "papaya", "parrot", "peanut", "pebble",
+	"pepper", "piano", "pickle", "pilot", "pine", "planet", "plum", "pocket",
+	"pony", "poppy", "pretzel", "prism", "puffin", "pumpkin", "quartz", "quill",
+	"rabbit", "radar", "raisin", "raven", "ribbon", "river", "rocket", "saddle",
+	"salmon", "satchel", "sequoia", "shovel", "silver", "sketch", "sparrow", "spruce",
+	"squid", "summit", "sunset", "tablet", "tango", "teapot", "thistle", "tiger",
+	"tulip", "tundra", "turtle", "umbrella", "valley", "velvet", "violin", "volcano",
+	"walnut", "walrus", "whistle", "willow", "wizard", "yogurt", "zebra", "zephyr",
+}